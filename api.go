@@ -0,0 +1,164 @@
+// Copyright 2016 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// APIs offered by Sansay SBCs. Newer OS versions offer REST, older ones only SOAP.
+const (
+	apiREST = "rest"
+	apiSOAP = "soap"
+	apiAuto = "auto"
+)
+
+type detectedAPI struct {
+	api  string
+	time time.Time
+}
+
+// apiCache remembers the API detected for each target, see collector.apiKey.
+type apiCache struct {
+	mtx     sync.Mutex
+	entries map[string]detectedAPI
+}
+
+func newAPICache() *apiCache {
+	return &apiCache{entries: map[string]detectedAPI{}}
+}
+
+// get returns the API detected for target, unless it was detected longer
+// than ttl ago.
+func (a *apiCache) get(target string, ttl time.Duration) (string, bool) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	entry, ok := a.entries[target]
+	if !ok {
+		return "", false
+	}
+	if time.Since(entry.time) > ttl {
+		delete(a.entries, target)
+		return "", false
+	}
+	return entry.api, true
+}
+
+func (a *apiCache) set(target, api string) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.entries[target] = detectedAPI{api: api, time: time.Now()}
+}
+
+func (a *apiCache) forget(target string) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	delete(a.entries, target)
+}
+
+// apis holds the APIs detected for targets of modules with api set to auto.
+var apis = newAPICache()
+
+// apiProbePath is the REST path requested to detect the API. Every SBC with
+// the REST API serves it, while other paths may be missing on some models.
+const apiProbePath = "stats/realtime"
+
+// apiKey identifies the detected API of the target, which depends on the
+// REST path of the module.
+func (c collector) apiKey() string {
+	return c.target + c.module.RestPath
+}
+
+// api returns the API used for the target, or an empty string if it has not
+// been detected yet.
+func (c collector) api() string {
+	if c.module.API != apiAuto {
+		return c.module.API
+	}
+	api, _ := apis.get(c.apiKey(), c.module.APIDetectionTTL)
+	return api
+}
+
+// callAPI requests path from the target using the module's API. With auto
+// detection the API is detected first and remembered for the target. The
+// caller closes the returned body.
+func callAPI(ctx context.Context, c collector, path string) (io.ReadCloser, error) {
+	switch c.module.API {
+	case apiREST:
+		return callRestAPI(ctx, c, path)
+	case apiSOAP:
+		return soapBody(callSoapAPI(ctx, c, path))
+	}
+
+	api, ok := apis.get(c.apiKey(), c.module.APIDetectionTTL)
+	if !ok {
+		var probe io.ReadCloser
+		var err error
+		api, probe, err = detectAPI(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		if probe != nil {
+			if path == apiProbePath {
+				return probe, nil
+			}
+			probe.Close()
+		}
+	}
+	if api == apiSOAP {
+		body, err := callSoapAPI(ctx, c, path)
+		if err != nil && ctx.Err() == nil {
+			// The SBC may have been upgraded, probe again on the next scrape.
+			apis.forget(c.apiKey())
+		}
+		return soapBody(body, err)
+	}
+	return callRestAPI(ctx, c, path)
+}
+
+// detectAPI requests the probe path over REST and remembers SOAP as the API
+// of the target if the SBC does not know it, REST otherwise. The body of the
+// probe is returned when the SBC answered it.
+func detectAPI(ctx context.Context, c collector) (string, io.ReadCloser, error) {
+	body, err := callRestAPI(ctx, c, apiProbePath)
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) && statusErr.code == http.StatusNotFound {
+		level.Debug(c.logger).Log("msg", "REST API not found, using SOAP", "path", apiProbePath)
+		apis.set(c.apiKey(), apiSOAP)
+		return apiSOAP, nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	apis.set(c.apiKey(), apiREST)
+	return apiREST, body, nil
+}
+
+// soapBody returns the payload of a SOAP reply as a body. The payload is
+// embedded in the SOAP envelope, so it is already read in full.
+func soapBody(payload []byte, err error) (io.ReadCloser, error) {
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(payload)), nil
+}
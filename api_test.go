@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/ringsq/sansay_exporter/config"
+)
+
+const soapRealtimeResponse = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>
+<ns2:realTimeStatsResult xmlns:ns2="http://ws.sansay.com"><retCode>0</retCode><xmlfile>&lt;mysqldump/&gt;</xmlfile></ns2:realTimeStatsResult>
+</soap:Body></soap:Envelope>`
+
+func TestCallAPIDetectsSOAP(t *testing.T) {
+	var restRequests, soapRequests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/SSConfig/SansayWS" {
+			atomic.AddInt32(&soapRequests, 1)
+			w.Header().Set("Content-Type", "text/xml")
+			w.Write([]byte(soapRealtimeResponse))
+			return
+		}
+		atomic.AddInt32(&restRequests, 1)
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	module := config.DefaultModule
+	c, err := newCollector(context.Background(), server.URL, &module, nil, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer apis.forget(c.apiKey())
+
+	for i := 0; i < 2; i++ {
+		body, err := readAPI(context.Background(), c, "stats/realtime")
+		if err != nil {
+			t.Fatalf("Call %d failed: %s", i, err)
+		}
+		if string(body) != "<mysqldump/>" {
+			t.Errorf("Unexpected body %q", body)
+		}
+	}
+	if restRequests != 1 || soapRequests != 2 {
+		t.Errorf("Expected 1 REST probe and 2 SOAP calls, got %d and %d", restRequests, soapRequests)
+	}
+	if c.api() != apiSOAP {
+		t.Errorf("Expected the detected API to be soap, got %q", c.api())
+	}
+}
+
+func TestCallAPIMissingRESTPath(t *testing.T) {
+	var soapRequests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/SSConfig/SansayWS":
+			atomic.AddInt32(&soapRequests, 1)
+			http.NotFound(w, r)
+		case "/SSConfig/webresources/stats/realtime":
+			w.Write([]byte("<mysqldump/>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	module := config.DefaultModule
+	c, err := newCollector(context.Background(), server.URL, &module, nil, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer apis.forget(c.apiKey())
+
+	// A path missing on a REST SBC fails alone, before and after detection.
+	for i := 0; i < 2; i++ {
+		if _, err := callAPI(context.Background(), c, "stats/system"); errorClass(err) != errorClassHTTPStatus {
+			t.Errorf("Call %d: expected an HTTP status error, got %v", i, err)
+		}
+	}
+	body, err := readAPI(context.Background(), c, "stats/realtime")
+	if err != nil || string(body) != "<mysqldump/>" {
+		t.Errorf("Unexpected body %q, err %v", body, err)
+	}
+	if soapRequests != 0 || c.api() != apiREST {
+		t.Errorf("Expected the REST API to be kept, got %q after %d SOAP calls", c.api(), soapRequests)
+	}
+}
+
+func TestCallAPIExplicitREST(t *testing.T) {
+	var soapRequests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/SSConfig/SansayWS" {
+			atomic.AddInt32(&soapRequests, 1)
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	module := config.DefaultModule
+	module.API = apiREST
+	c, err := newCollector(context.Background(), server.URL, &module, nil, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := callAPI(context.Background(), c, "stats/realtime"); errorClass(err) != errorClassHTTPStatus {
+		t.Errorf("Expected an HTTP status error, got %v", err)
+	}
+	if soapRequests != 0 {
+		t.Error("SOAP API used although the module uses REST")
+	}
+}
+
+func TestCallSoapAPIErrors(t *testing.T) {
+	tests := []struct {
+		response string
+		want     string
+	}{
+		{
+			response: `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>
+<ns2:realTimeStatsResult xmlns:ns2="http://ws.sansay.com"><retCode>1</retCode><msg>Invalid user</msg></ns2:realTimeStatsResult>
+</soap:Body></soap:Envelope>`,
+			want: errorClassRetCode,
+		},
+		{
+			response: `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>
+<ns2:realTimeStatsResult xmlns:ns2="http://ws.sansay.com"><retCode>0</retCode><xmlfile> </xmlfile></ns2:realTimeStatsResult>
+</soap:Body></soap:Envelope>`,
+			want: errorClassEmpty,
+		},
+		{
+			response: `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>
+<soap:Fault><faultcode>soap:Server</faultcode><faultstring>Internal error</faultstring></soap:Fault>
+</soap:Body></soap:Envelope>`,
+			want: errorClassSOAPFault,
+		},
+	}
+	for _, tt := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/xml")
+			w.Write([]byte(tt.response))
+		}))
+		module := config.DefaultModule
+		module.API = apiSOAP
+		c, err := newCollector(context.Background(), server.URL, &module, nil, log.NewNopLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = callAPI(context.Background(), c, "stats/realtime")
+		if got := errorClass(err); got != tt.want {
+			t.Errorf("Expected error class %s, got %s (%v)", tt.want, got, err)
+		}
+		server.Close()
+	}
+	if _, err := callSoapAPI(context.Background(), collector{target: "127.0.0.1:1", module: &config.DefaultModule, logger: log.NewNopLogger(), transport: newTargetTransport(nil, 0)}, "stats/realtime"); errorClass(err) != errorClassTransport {
+		t.Errorf("Expected a transport error, got %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2016 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command sansay-sim simulates the REST and SOAP APIs of a Sansay SBC from
+// fixture files, so the exporter can be tested without an SBC.
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/common/promlog"
+	"github.com/prometheus/common/promlog/flag"
+	"github.com/ringsq/sansay_exporter/simulator"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	listenAddress = kingpin.Flag("web.listen-address", "Address to serve the simulated APIs on.").Default(":8888").String()
+	fixturesDir   = kingpin.Flag("fixtures.dir", "Directory holding the fixture files, named after the API paths, e.g. stats_realtime.xml.").Default("testdata").String()
+	username      = kingpin.Flag("auth.username", "Username required by the APIs, none if empty.").String()
+	password      = kingpin.Flag("auth.password", "Password required by the APIs.").String()
+	latency       = kingpin.Flag("latency", "Delay added to every response.").Default("0s").Duration()
+	errorRate     = kingpin.Flag("error.rate", "Fraction of requests answered with an error.").Default("0").Float64()
+	errorKind     = kingpin.Flag("error.kind", "Kind of error injected: "+strings.Join(simulator.ErrorKinds, ", ")+".").Default(simulator.ErrorStatus).Enum(simulator.ErrorKinds...)
+	pageSize      = kingpin.Flag("page.size", "Resources per page of SOAP downloads, 0 for a single page.").Default("0").Int()
+	disableREST   = kingpin.Flag("rest.disable", "Only offer the SOAP API, like older SBCs.").Default("false").Bool()
+)
+
+func main() {
+	promlogConfig := &promlog.Config{}
+	flag.AddFlags(kingpin.CommandLine, promlogConfig)
+	kingpin.HelpFlag.Short('h')
+	kingpin.Parse()
+	logger := promlog.New(promlogConfig)
+
+	sim, err := simulator.New(simulator.Config{
+		FixturesDir: *fixturesDir,
+		Username:    *username,
+		Password:    *password,
+		Latency:     *latency,
+		ErrorRate:   *errorRate,
+		ErrorKind:   *errorKind,
+		PageSize:    *pageSize,
+		DisableREST: *disableREST,
+	}, logger)
+	if err != nil {
+		level.Error(logger).Log("msg", "Error creating simulator", "err", err)
+		os.Exit(1)
+	}
+
+	level.Info(logger).Log("msg", "Simulating SBC", "address", *listenAddress, "fixtures", *fixturesDir)
+	if err := http.ListenAndServe(*listenAddress, sim); err != nil {
+		level.Error(logger).Log("msg", "Error starting HTTP server", "err", err)
+		os.Exit(1)
+	}
+}
@@ -14,20 +14,21 @@
 package main
 
 import (
-	"crypto/tls"
+	"bytes"
+	"context"
 	"encoding/xml"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net/http"
 	"net/url"
-	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
-	"unicode"
 
+	"github.com/ringsq/sansay_exporter/config"
 	"github.com/ringsq/sansay_exporter/models"
 
 	"github.com/go-kit/kit/log"
@@ -36,6 +37,24 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// limiter bounds the requests in flight to the targets.
+var limiter = newRequestLimiter(0, 0)
+
+// clients holds the HTTP transports used for requests to the targets.
+var clients = newClientPool(90*time.Second, 30*time.Minute)
+
+// scrapes coalesces identical scrapes running at the same time.
+var scrapes = newScrapeGroup()
+
+// collectorPaths maps the sub-collector names to the API path they scrape.
+var collectorPaths = map[string]string{
+	"realtime":        "stats/realtime",
+	"resource":        "stats/resource",
+	"media_server":    "stats/media_server",
+	"resource_config": "download/resource",
+	"system":          "stats/system",
+}
+
 var realtimeMetrics = []string{"NumOrig",
 	"NumTerm",
 	"Cps",
@@ -45,26 +64,6 @@ var realtimeMetrics = []string{"NumOrig",
 	"TotalLimit",
 	"CpsLimit"}
 
-type Sansay struct {
-	XMLName  xml.Name `xml:"mysqldump"`
-	Text     string   `xml:",chardata"`
-	Database struct {
-		Text  string `xml:",chardata"`
-		Name  string `xml:"name,attr"`
-		Table []struct {
-			Text string `xml:",chardata"`
-			Name string `xml:"name,attr"`
-			Row  []struct {
-				Text  string `xml:",chardata"`
-				Field []struct {
-					Text string `xml:",chardata"`
-					Name string `xml:"name,attr"`
-				} `xml:"field"`
-			} `xml:"row"`
-		} `xml:"table"`
-	} `xml:"database"`
-}
-
 type XBMediaServerRealTimeStatList struct {
 	XMLName                   xml.Name `xml:"XBMediaServerRealTimeStatList"`
 	Text                      string   `xml:",chardata"`
@@ -130,12 +129,48 @@ type Trunk struct {
 	Direction             string
 }
 type collector struct {
+	ctx        context.Context
 	target     string
-	targetPath string
-	username   string
-	password   string
+	module     *config.Module
+	collectors []string
 	logger     log.Logger
-	useSoap    bool
+	transport  *targetTransport
+	// When set, metrics are served from the poller's cache instead of
+	// scraping the target.
+	cache *targetCache
+}
+
+// statsMetrics are the metrics created from a mysqldump payload as it was
+// decoded.
+type statsMetrics []prometheus.Metric
+
+// scrapeResult is the outcome of scraping one API path.
+type scrapeResult struct {
+	path     string
+	obj      interface{}
+	err      error
+	duration time.Duration
+}
+
+// newCollector creates a collector for the target using the settings of module.
+// Requests to the target are cancelled when ctx is done. Only the named
+// sub-collectors are run, or all those enabled in the module if none are given.
+func newCollector(ctx context.Context, target string, module *config.Module, collectors []string, logger log.Logger) (collector, error) {
+	if len(collectors) == 0 {
+		collectors = module.Collectors
+	}
+	transport, err := clients.get(target, module)
+	if err != nil {
+		return collector{}, err
+	}
+	return collector{
+		ctx:        ctx,
+		target:     target,
+		module:     module,
+		collectors: collectors,
+		logger:     logger,
+		transport:  transport,
+	}, nil
 }
 
 func init() {
@@ -151,44 +186,176 @@ func (c collector) Describe(ch chan<- *prometheus.Desc) {
 
 // Collect implements Prometheus.Collector.
 func (c collector) Collect(ch chan<- prometheus.Metric) {
-	paths := []string{"stats/realtime", "stats/resource", "stats/media_server", "download/resource"}
-	var wg sync.WaitGroup
-	var err error
 	start := time.Now()
-	results := make(chan interface{})
-	defer close(results)
+	if c.cache != nil {
+		c.cache.collect(ch, c.collectors)
+	} else {
+		// The results are processed once for all callers, so the error
+		// counters are not incremented again by every caller that joined.
+		outcome, shared, err := scrapes.Do(c.ctx, c.scrapeKey(), c.module.Timeout, func(ctx context.Context) scrapeOutcome {
+			var outcome scrapeOutcome
+			results := c.scrape(ctx)
+			outcome.metrics = gatherMetrics(func(ch chan<- prometheus.Metric) {
+				outcome.up = c.processResults(ch, results)
+			})
+			outcome.expiry, _ = c.transport.Expiry()
+			return outcome
+		})
+		if shared && err == nil {
+			level.Debug(c.logger).Log("msg", "Coalesced with a scrape already in flight")
+			sansayCoalescedRequests.Inc()
+		}
+		if err != nil {
+			// Gave up waiting for the scrape.
+			var results []scrapeResult
+			for _, path := range c.paths() {
+				results = append(results, scrapeResult{path: path, err: err})
+			}
+			outcome.up = c.processResults(ch, results)
+		}
+		for _, m := range outcome.metrics {
+			ch <- m
+		}
+		sendTargetMetrics(ch, outcome.up, outcome.expiry, c.api())
+	}
+	ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc("sansay_scrape_duration_seconds", "Total sansay time scrape took (walk and processing).", nil, nil),
+		prometheus.GaugeValue,
+		time.Since(start).Seconds())
+
+}
+
+// sendTargetMetrics sends the metrics describing the target as a whole. The
+// certificate expiry is omitted when no TLS connection was made, and the API
+// when it is not known yet.
+func sendTargetMetrics(ch chan<- prometheus.Metric, up bool, expiry time.Time, api string) {
+	value := 0.0
+	if up {
+		value = 1
+	}
+	ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc("sansay_up", "Whether the target answered at least one collector", nil, nil),
+		prometheus.GaugeValue,
+		value)
+	if !expiry.IsZero() {
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc("sansay_target_tls_cert_expiry_timestamp_seconds", "Returns earliest expiry date of the certificates served by the target", nil, nil),
+			prometheus.GaugeValue,
+			float64(expiry.Unix()))
+	}
+	if api != "" {
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc("sansay_target_api_info", "The API used to query the target", []string{"api"}, nil),
+			prometheus.GaugeValue,
+			1, api)
+	}
+}
+
+// paths returns the API paths scraped by the collector's sub-collectors.
+func (c collector) paths() []string {
+	paths := make([]string, 0, len(c.collectors))
+	seen := make(map[string]bool, len(c.collectors))
+	for _, name := range c.collectors {
+		path := collectorPaths[name]
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// scrapeKey identifies scrapes that query the same target, with the same
+// module, for the same paths.
+func (c collector) scrapeKey() string {
+	return fmt.Sprintf("%s|%p|%s", c.target, c.module, strings.Join(c.paths(), ","))
+}
+
+// scrape runs the collector's sub-collectors against the target concurrently.
+func (c collector) scrape(ctx context.Context) []scrapeResult {
+	paths := c.paths()
+	var wg sync.WaitGroup
+	results := make(chan scrapeResult)
 	for _, path := range paths {
 		wg.Add(1)
-		go ScrapeTarget(c, path, results, &wg)
+		go ScrapeTarget(ctx, c, path, results, &wg)
 	}
+	collected := make([]scrapeResult, 0, len(paths))
 	for i := 0; i < len(paths); i++ {
-		result := <-results
-		switch obj := result.(type) {
-		case Sansay:
-			err = nil
-			c.processCollection(ch, obj)
+		collected = append(collected, <-results)
+	}
+	wg.Wait()
+	close(results)
+	return collected
+}
+
+// processResults creates the metrics for the scraped paths. It returns
+// whether any sub-collector succeeded.
+func (c collector) processResults(ch chan<- prometheus.Metric, results []scrapeResult) bool {
+	up := false
+	for _, result := range results {
+		if c.processResult(ch, result) {
+			up = true
+		}
+	}
+	return up
+}
+
+// processResult creates the metrics for one scraped path, along with the
+// success, duration and error metrics of its sub-collector. It returns whether
+// the sub-collector succeeded.
+func (c collector) processResult(ch chan<- prometheus.Metric, result scrapeResult) bool {
+	name := collectorName(result.path)
+	err := result.err
+	if err == nil {
+		switch obj := result.obj.(type) {
+		case statsMetrics:
+			for _, m := range obj {
+				ch <- m
+			}
 		case XBMediaServerRealTimeStatList:
-			err = nil
 			c.processMediaCollection(ch, obj)
 		case models.XBResourceList:
-			err = nil
 			c.processXBResourceList(ch, obj)
-		case error:
-			err = obj
 		default:
 			err = errors.New("Invalid type returned from target")
 		}
-		if err != nil {
-			level.Info(c.logger).Log("msg", "Error scraping target", "err", err)
+	}
+	success := 0.0
+	if err != nil {
+		class := errorClass(err)
+		level.Info(c.logger).Log("msg", "Error scraping target", "collector", name, "class", class, "err", err)
+		sansayCollectorErrors.WithLabelValues(name, class).Inc()
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc("sansay_collector_error", "The class of error that made the collector fail", []string{"collector", "class"}, nil),
+			prometheus.GaugeValue,
+			1, name, class)
+		if c.module.Strict {
 			ch <- prometheus.NewInvalidMetric(prometheus.NewDesc("sansay_error", "Error scraping target", nil, nil), err)
 		}
+	} else {
+		success = 1
 	}
-	wg.Wait()
 	ch <- prometheus.MustNewConstMetric(
-		prometheus.NewDesc("sansay_scrape_duration_seconds", "Total sansay time scrape took (walk and processing).", nil, nil),
+		prometheus.NewDesc("sansay_collector_success", "Whether the collector succeeded", []string{"collector"}, nil),
 		prometheus.GaugeValue,
-		time.Since(start).Seconds())
+		success, name)
+	ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc("sansay_collector_duration_seconds", "Duration of the request made by the collector", []string{"collector"}, nil),
+		prometheus.GaugeValue,
+		result.duration.Seconds(), name)
+	return err == nil
+}
 
+// collectorName returns the name of the sub-collector scraping path.
+func collectorName(path string) string {
+	for name, p := range collectorPaths {
+		if p == path {
+			return name
+		}
+	}
+	return path
 }
 
 // processMediaCollection creates the metrics for the media server statistics.  The media server stats are
@@ -207,9 +374,15 @@ func (c collector) processMediaCollection(ch chan<- prometheus.Metric, media XBM
 		if mediaServer.Status == "up" {
 			status = "1"
 		}
-		addLabeledMetric(ch, "mediaserver_up", status, labels, labelValues)
-		addLabeledMetric(ch, "mediaserver_sessions_limit", mediaServer.MaxConnections, labels, labelValues)
-		addLabeledMetric(ch, "mediaserver_sessions", mediaServer.NumActiveSessions, labels, labelValues)
+		if err := addLabeledMetric(ch, "mediaserver_up", status, labels, labelValues); err != nil {
+			c.countParseError("XBMediaServerRealTimeStatList", "status", err)
+		}
+		if err := addLabeledMetric(ch, "mediaserver_sessions_limit", mediaServer.MaxConnections, labels, labelValues); err != nil {
+			c.countParseError("XBMediaServerRealTimeStatList", "maxConnections", err)
+		}
+		if err := addLabeledMetric(ch, "mediaserver_sessions", mediaServer.NumActiveSessions, labels, labelValues); err != nil {
+			c.countParseError("XBMediaServerRealTimeStatList", "numActiveSessions", err)
+		}
 	}
 }
 
@@ -217,128 +390,155 @@ func (c collector) processMediaCollection(ch chan<- prometheus.Metric, media XBM
 func (c collector) processXBResourceList(ch chan<- prometheus.Metric, resources models.XBResourceList) {
 	labels := []string{"trunkgroup", "alias"}
 	var labelValues []string
-	for _, resource := range resources.XBResource {
+	for i := range resources.XBResource {
+		resource := &resources.XBResource[i]
 		labelValues = []string{resource.TrunkId, resource.Name}
-		addLabeledMetric(ch, "config_trunk_sessions_max", resource.Capacity, labels, labelValues)
-		addLabeledMetric(ch, "config_trunk_cps_max", resource.CpsLimit, labels, labelValues)
-	}
-}
-
-func (c collector) processCollection(ch chan<- prometheus.Metric, sansay Sansay) {
-	for _, table := range sansay.Database.Table {
-		var direction string
-		switch table.Name {
-		case "system_stat":
-			for _, row := range table.Row {
-				for _, field := range row.Field {
-					switch field.Name {
-					case "ha_pre_state":
-					case "ha_current_state":
-					default:
-						addMetric(ch, field.Name, field.Text)
-					}
-				}
-			}
-		case "XBResourceRealTimeStatList":
-			for _, row := range table.Row {
-				trunk := Trunk{}
-				for _, field := range row.Field {
-					err := setField(&trunk, field.Name, field.Text)
-					if err != nil {
-						ch <- prometheus.NewInvalidMetric(prometheus.NewDesc("sansay_error", "Error scraping target", nil, nil), err)
-					}
-				}
-				if trunk.Fqdn == "Group" {
-					err := addTrunkMetrics(ch, trunk, realtimeMetrics)
-					if err != nil {
-						ch <- prometheus.NewInvalidMetric(prometheus.NewDesc("sansay_error", "Error scraping target", nil, nil), err)
-					}
-				}
-			}
-			// Resource tables
-		case "ingress_stat":
-			direction = "ingress"
-			fallthrough
-		case "gw_egress_stat":
-			if direction == "" {
-				direction = "egress"
-			}
-			for _, row := range table.Row {
-				trunk := Trunk{}
-				trunk.Direction = direction
-				for _, field := range row.Field {
-					if field.Name == "trunk_id" {
-						field.Name = "trunkId"
-					}
-					fieldName, ok := trunkfields[field.Name]
-					if !ok {
-						fieldName = field.Name
-					}
-					err := setField(&trunk, fieldName, field.Text)
-					if err != nil {
-						ch <- prometheus.NewInvalidMetric(prometheus.NewDesc("sansay_error", "Error scraping target", nil, nil), err)
-					}
-				}
-				err := addTrunkMetrics(ch, trunk, resourceMetrics)
-				if err != nil {
-					ch <- prometheus.NewInvalidMetric(prometheus.NewDesc("sansay_error", "Error scraping target", nil, nil), err)
+		if err := addLabeledMetric(ch, "config_trunk_sessions_max", resource.Capacity, labels, labelValues); err != nil {
+			c.countParseError("XBResourceList", "capacity", err)
+		}
+		if err := addLabeledMetric(ch, "config_trunk_cps_max", resource.CpsLimit, labels, labelValues); err != nil {
+			c.countParseError("XBResourceList", "cpsLimit", err)
+		}
+		c.addTrunkConfigMetrics(ch, resource, labels, labelValues)
+		c.addTrunkStateMetrics(ch, resource, labelValues)
+	}
+}
+
+// processStats decodes a mysqldump payload from r and creates the metrics for
+// the system and trunk statistics of each row as it is read.
+func (c collector) processStats(ch chan<- prometheus.Metric, r io.Reader) error {
+	return decodeStats(r, func(table string, fields []statsField) {
+		c.processRow(ch, table, fields)
+	})
+}
+
+// processRow creates the metrics for a row of the table of a mysqldump payload.
+func (c collector) processRow(ch chan<- prometheus.Metric, table string, fields []statsField) {
+	switch table {
+	case "system_stat":
+		var haCurrent, haPrevious string
+		for _, field := range fields {
+			switch field.name {
+			case "ha_pre_state":
+				haPrevious = field.value
+			case "ha_current_state":
+				haCurrent = field.value
+			default:
+				if err := addMetric(ch, field.name, field.value); err != nil {
+					c.countParseError(table, field.name, err)
 				}
 			}
 		}
+		c.addHAMetrics(ch, haCurrent, haPrevious)
+	case "XBResourceRealTimeStatList":
+		trunk := newTrunk(table, fields)
+		// Multi-node trunks have a row per node besides the Group row
+		// of the whole trunk.
+		if trunk.Fqdn == "Group" {
+			c.addTrunkMetrics(ch, table, trunk, realtimeMetrics, "")
+		} else if c.module.RealtimeNodes && trunk.Fqdn != "" {
+			c.addTrunkMetrics(ch, table, trunk, realtimeMetrics, trunk.Fqdn)
+		}
+		// Resource tables
+	case "ingress_stat", "gw_egress_stat":
+		c.addTrunkMetrics(ch, table, newTrunk(table, fields), resourceMetrics, "")
+	default:
+		if _, ok := systemTables[table]; ok {
+			c.addSystemMetrics(ch, table, fields)
+		}
+	}
+}
+
+// countParseError records a field of the SBC payload that could not be parsed.
+func (c collector) countParseError(table, field string, err error) {
+	sansayParseErrors.WithLabelValues(table, field).Inc()
+	level.Debug(c.logger).Log("msg", "Error parsing field", "table", table, "field", field, "err", err)
+}
+
+// reportParseError counts a field that could not be parsed. In strict mode it
+// also fails the scrape, otherwise the remaining metrics are still served.
+func (c collector) reportParseError(ch chan<- prometheus.Metric, table, field string, err error) {
+	c.countParseError(table, field, err)
+	if c.module.Strict {
+		ch <- prometheus.NewInvalidMetric(prometheus.NewDesc("sansay_error", "Error scraping target", nil, nil), err)
 	}
 }
 
 // ScrapeTarget scrapes the Sansay API
-func ScrapeTarget(c collector, path string, result chan<- interface{}, wg *sync.WaitGroup) {
+func ScrapeTarget(ctx context.Context, c collector, path string, result chan<- scrapeResult, wg *sync.WaitGroup) {
+	defer wg.Done()
 	logger := c.logger
+	start := time.Now()
 	var obj interface{}
-	var sansay Sansay
-	var media XBMediaServerRealTimeStatList
-	var resourceList models.XBResourceList
-	var body []byte
+	var body io.ReadCloser
 	var err error
 
-	if c.useSoap {
-		body, err = callSoapAPI(c, path)
-		if err != nil {
-			result <- err
-			wg.Done()
-			return
-		}
+	if replayDir != "" {
+		body, err = readReplay(c, path)
 	} else {
-		body, err = callRestAPI(c, path)
+		var release func()
+		release, err = limiter.acquire(ctx, c.target, c.module.Name, c.module.MaxConcurrentRequests, c.module.MaxQueuedRequests)
 		if err != nil {
-			result <- err
-			wg.Done()
+			level.Debug(logger).Log("msg", "No slot for request", "path", path, "err", err)
+			result <- scrapeResult{path: path, err: err, duration: time.Since(start)}
 			return
 		}
+		defer release()
+		body, err = callAPI(ctx, c, path)
+	}
+	if err != nil {
+		result <- scrapeResult{path: path, err: err, duration: time.Since(start)}
+		return
 	}
+	defer body.Close()
+	// The payload is decoded while it is read, the statistics are turned
+	// into metrics row by row.
 	if strings.HasSuffix(path, "media_server") {
-		err = xml.Unmarshal(body, &media)
+		var media XBMediaServerRealTimeStatList
+		err = xml.NewDecoder(body).Decode(&media)
 		obj = media
 	} else if strings.HasSuffix(path, "download/resource") {
-		err = xml.Unmarshal(body, &resourceList)
+		var resourceList models.XBResourceList
+		err = xml.NewDecoder(body).Decode(&resourceList)
 		obj = resourceList
 	} else {
-		err = xml.Unmarshal(body, &sansay)
-		obj = sansay
+		obj = statsMetrics(gatherMetrics(func(ch chan<- prometheus.Metric) {
+			err = c.processStats(ch, body)
+		}))
+	}
+	var transportErr *transportError
+	if errors.As(err, &transportErr) {
+		level.Error(logger).Log("msg", "Error reading HTTP response body", "path", path, "err", err)
+		result <- scrapeResult{path: path, err: err, duration: time.Since(start)}
+		return
 	}
 	if err != nil {
 		level.Error(logger).Log("msg", "Error parsing XML", "path", path, "err", err)
-		result <- err
-		wg.Done()
+		result <- scrapeResult{path: path, err: &parseError{err: err}, duration: time.Since(start)}
 		return
 	}
-	result <- obj
-	wg.Done()
-	return
+	result <- scrapeResult{path: path, obj: obj, duration: time.Since(start)}
+}
+
+// responseBody is the body of a REST response. Errors reading it are
+// returned as transport errors, to tell them from errors in the payload.
+type responseBody struct {
+	io.ReadCloser
 }
 
-func callRestAPI(c collector, path string) ([]byte, error) {
-	username := c.username
-	password := c.password
+func (b responseBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		err = &transportError{err: err}
+	}
+	return n, err
+}
+
+func callRestAPI(ctx context.Context, c collector, path string) (io.ReadCloser, error) {
+	username := c.module.Username
+	password := string(c.module.Password)
 	logger := c.logger
-	target := fmt.Sprintf("%s%s%s", c.target, c.targetPath, path)
+	target := fmt.Sprintf("%s%s%s", c.target, c.module.RestPath, path)
 	if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
 		target = "http://" + target
 	}
@@ -348,8 +548,8 @@ func callRestAPI(c collector, path string) ([]byte, error) {
 		level.Error(logger).Log("msg", "Could not parse target URL", "err", err)
 		return nil, err
 	}
-	client := &http.Client{}
-	request, err := http.NewRequest("GET", target, http.NoBody)
+	client := &http.Client{Transport: c.transport}
+	request, err := http.NewRequestWithContext(ctx, "GET", target, http.NoBody)
 	if err != nil {
 		level.Error(logger).Log("msg", "Error creating HTTP request", "err", err)
 		return nil, err
@@ -360,34 +560,18 @@ func callRestAPI(c collector, path string) ([]byte, error) {
 
 	if err != nil {
 		level.Error(logger).Log("msg", "Error for HTTP request", "err", err)
-		return nil, err
+		return nil, &transportError{err: err}
 	}
 	level.Info(logger).Log("msg", "Received HTTP response", "status_code", resp.StatusCode)
-	if resp.StatusCode == 404 {
-		resp.Body.Close()
-		return callSoapAPI(c, path)
-	}
-	defer resp.Body.Close()
 	if resp.StatusCode > 300 {
-		err = fmt.Errorf("Invalid response from server: %d", resp.StatusCode)
-		return nil, err
-	}
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		level.Info(logger).Log("msg", "Failed to read HTTP response body", "err", err)
-		return nil, err
-	}
-	if err != nil {
-		return nil, err
+		resp.Body.Close()
+		return nil, &httpStatusError{code: resp.StatusCode}
 	}
-	return body, nil
+	return responseBody{resp.Body}, nil
 }
 
 // callSoapAPI makes a SOAP call to the Sansay SBC -- used for older OS versions
-func callSoapAPI(c collector, path string) ([]byte, error) {
-	var err error
-	var response []byte
+func callSoapAPI(ctx context.Context, c collector, path string) ([]byte, error) {
 	var statName string
 
 	// Determine the stat name by splitting the path
@@ -398,50 +582,70 @@ func callSoapAPI(c collector, path string) ([]byte, error) {
 		statName = paths[len(paths)-1]
 	}
 
-	target := fmt.Sprintf("%s%s", c.target, "/SSConfig/SansayWS")
+	target := fmt.Sprintf("%s%s", c.target, c.module.SoapPath)
 	if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
 		target = "http://" + target
 	}
-	client := soap.NewClient(target, soap.WithTLS(&tls.Config{InsecureSkipVerify: true}))
+	client := soap.NewClient(target, soap.WithHTTPClient(&http.Client{Transport: c.transport}))
 	service := NewSansayWS(client)
 	if strings.HasSuffix(path, "download/resource") {
-		params := &DownloadParams{
-			Username: c.username,
-			Password: c.password,
-			Page:     0,
-			Table:    "resource",
-		}
-
-		if reply, err := service.DoDownloadXmlFile(params); err == nil {
-			response = []byte(reply.Xmlfile)
-		}
-	} else {
-		params := &RealTimeStatsParams{
-			Username: c.username,
-			Password: c.password,
-			StatName: statName,
-		}
-		if reply, err := service.DoRealTimeStats(params); err == nil {
-			response = []byte(reply.Xmlfile)
-		}
+		return downloadResources(ctx, c, service, path)
+	}
+	if strings.HasSuffix(path, "stats/system") {
+		return systemStats(ctx, c, service, path)
 	}
+	params := &RealTimeStatsParams{
+		Username: c.module.Username,
+		Password: string(c.module.Password),
+		StatName: statName,
+	}
+	reply, err := service.DoRealTimeStatsContext(ctx, params)
 	if err != nil {
-		level.Error(c.logger).Log("msg", "Error calling SOAP API", "err", err)
-		return nil, err
+		return nil, soapCallError(c, path, err)
+	}
+	if reply.RetCode != 0 {
+		return nil, soapRetCodeError(c, path, reply.RetCode, reply.Msg)
+	}
+	response := []byte(reply.Xmlfile)
+	if len(bytes.TrimSpace(response)) == 0 {
+		level.Error(c.logger).Log("msg", "Empty payload from SOAP API", "path", path)
+		return nil, &emptyPayloadError{}
 	}
 	return response, nil
 }
 
+// soapCallError logs a failed SOAP call and returns its error, typed as a
+// transport error unless the SBC answered with a SOAP fault.
+func soapCallError(c collector, path string, err error) error {
+	if fault, ok := err.(*soap.SOAPFault); ok {
+		level.Error(c.logger).Log("msg", "SOAP fault from target", "path", path, "code", fault.Code, "fault", fault.String)
+		return fault
+	}
+	level.Error(c.logger).Log("msg", "Error calling SOAP API", "path", path, "err", err)
+	return &transportError{err: err}
+}
+
+// soapRetCodeError logs a SOAP reply with a non-zero retCode and returns it as an error.
+func soapRetCodeError(c collector, path string, code int32, msg string) error {
+	level.Error(c.logger).Log("msg", "SOAP API returned an error", "path", path, "ret_code", code, "sbc_msg", msg)
+	return &retCodeError{code: code, msg: msg}
+}
+
 func addMetric(ch chan<- prometheus.Metric, name string, value string) error {
 	metricName := fmt.Sprintf("sansay_%s", name)
 	floatValue, err := strconv.ParseFloat(value, 64)
 	if err != nil {
 		return err
 	}
-	ch <- prometheus.MustNewConstMetric(
+	// The name comes from the SBC and may not be a valid metric name.
+	metric, err := prometheus.NewConstMetric(
 		prometheus.NewDesc(metricName, "", nil, nil),
 		prometheus.GaugeValue,
 		floatValue)
+	if err != nil {
+		return err
+	}
+	ch <- metric
 	return nil
 }
 
@@ -458,29 +662,58 @@ func addLabeledMetric(ch chan<- prometheus.Metric, name string, value string, la
 	return nil
 }
 
-func addTrunkMetrics(ch chan<- prometheus.Metric, trunk Trunk, metricNames []string) error {
+// sendStateSet sends a series of desc for each of the states, 1 for the
+// current state and 0 for the others. A current state not among the states is
+// sent as well. The state label must follow the labelValues.
+func sendStateSet(ch chan<- prometheus.Metric, desc *prometheus.Desc, states []string, current string, labelValues ...string) {
+	values := append(append([]string(nil), labelValues...), "")
+	known := false
+	for _, state := range states {
+		value := 0.0
+		if state == current {
+			value = 1
+			known = true
+		}
+		values[len(values)-1] = state
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, values...)
+	}
+	if !known {
+		values[len(values)-1] = current
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1, values...)
+	}
+}
+
+// addTrunkMetrics creates the metrics of a trunk. With a node, the metrics
+// describe one node of a multi-node trunk; they are named apart from those of
+// the whole trunk so that sums over trunks are not doubled.
+func (c collector) addTrunkMetrics(ch chan<- prometheus.Metric, table string, trunk Trunk, metricNames []string, node string) {
 	for _, metric := range metricNames {
 		baseName := strings.ToLower(metric)
-		metricName := fmt.Sprintf("sansay_trunk_%s", baseName)
+		metricName := "sansay_trunk_" + baseName
 
-		value, err := getField(&trunk, metric)
+		value, err := trunk.get(metric)
 		if err != nil {
-			ch <- prometheus.NewInvalidMetric(prometheus.NewDesc("sansay_error", "Error scraping target", nil, nil), err)
+			c.reportParseError(ch, table, metric, err)
 			continue
 		}
 		floatValue, err := strconv.ParseFloat(value, 64)
 		if err != nil {
-			ch <- prometheus.NewInvalidMetric(prometheus.NewDesc("sansay_error", "Error scraping target", nil, nil), err)
+			c.reportParseError(ch, table, metric, err)
 			continue
 		}
 		//fmt.Printf("New Metric: %s TG=%s Alias=%s\n", metricName, trunk.TrunkId, trunk.Alias)
 		labels := []string{"trunkgroup", "alias"}
 		labelValues := []string{trunk.TrunkId, trunk.Alias}
+		if node != "" {
+			labels = append(labels, "node")
+			labelValues = append(labelValues, node)
+		}
 		if trunk.Direction != "" {
 			labels = append(labels, "direction")
 			labelValues = append(labelValues, trunk.Direction)
+			// Call counters are named <period>_calls_<status>.
 			fieldName := strings.Split(baseName, "_")
-			if fieldName[1] == "calls" {
+			if len(fieldName) == 3 && fieldName[1] == "calls" {
 				labels = append(labels, "status")
 				labelValues = append(labelValues, fieldName[2])
 				metricName = metricName[0:strings.LastIndex(metricName, "_")]
@@ -491,68 +724,4 @@ func addTrunkMetrics(ch chan<- prometheus.Metric, trunk Trunk, metricNames []str
 			prometheus.GaugeValue,
 			floatValue, labelValues...)
 	}
-	return nil
-}
-
-// setField sets field of v with given name to given value.
-func setField(v interface{}, name string, value string) error {
-	// v must be a pointer to a struct
-	nme := []rune(name)
-	nme[0] = unicode.ToUpper(nme[0])
-	name = string(nme)
-	rv := reflect.ValueOf(v)
-	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
-		return errors.New("v must be pointer to struct")
-	}
-
-	// Dereference pointer
-	rv = rv.Elem()
-
-	// Lookup field by name
-	fv := rv.FieldByName(name)
-	if !fv.IsValid() {
-		return nil // fmt.Errorf("not a field name: %s", name)
-	}
-
-	// Field must be exported
-	if !fv.CanSet() {
-		return fmt.Errorf("cannot set field %s", name)
-	}
-
-	// We expect a string field
-	if fv.Kind() != reflect.String {
-		return fmt.Errorf("%s is not a string field", name)
-	}
-
-	// Set the value
-	fv.SetString(value)
-	return nil
-}
-
-// setField sets field of v with given name to given value.
-func getField(v interface{}, name string) (string, error) {
-	// v must be a pointer to a struct
-	nme := []rune(name)
-	nme[0] = unicode.ToUpper(nme[0])
-	name = string(nme)
-	rv := reflect.ValueOf(v)
-	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
-		return "", errors.New("v must be pointer to struct")
-	}
-
-	// Dereference pointer
-	rv = rv.Elem()
-
-	// Lookup field by name
-	fv := rv.FieldByName(name)
-	if !fv.IsValid() {
-		return "", fmt.Errorf("not a field name: %s", name)
-	}
-
-	// We expect a string field
-	if fv.Kind() != reflect.String {
-		return "", fmt.Errorf("%s is not a string field", name)
-	}
-
-	return fv.String(), nil
 }
@@ -1,61 +1,269 @@
 package main
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/go-kit/kit/log"
-	"github.com/jarcoal/httpmock"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/ringsq/sansay_exporter/config"
+	"github.com/ringsq/sansay_exporter/simulator"
 )
 
 func TestScrapeTarget(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		status    int
+		body      string
+		length    int
+		wantClass string
+	}{
+		{name: "stats", path: "stats/realtime", status: 200, body: `<mysqldump><database name="sansay"></database></mysqldump>`},
+		{name: "invalid XML", path: "stats/realtime", status: 200, body: "<xml>response", wantClass: errorClassParse},
+		{name: "wrong document", path: "stats/media_server", status: 200, body: "<xml>response</xml>", wantClass: errorClassParse},
+		{name: "HTTP error", path: "stats/realtime", status: 500, body: "error", wantClass: errorClassHTTPStatus},
+		{name: "truncated body", path: "stats/realtime", status: 200, body: `<mysqldump><database name="sansay">`, length: 1000, wantClass: errorClassTransport},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != config.DefaultModule.RestPath+tt.path {
+					http.NotFound(w, r)
+					return
+				}
+				if tt.length > 0 {
+					w.Header().Set("Content-Length", strconv.Itoa(tt.length))
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			module := config.DefaultModule
+			module.API = apiREST
+			module.Username = "user"
+			module.Password = "pass"
+			c, err := newCollector(context.Background(), server.URL, &module, nil, log.NewNopLogger())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var wg sync.WaitGroup
+			results := make(chan scrapeResult, 1)
+			wg.Add(1)
+			ScrapeTarget(context.Background(), c, tt.path, results, &wg)
+			result := <-results
+			if tt.wantClass == "" {
+				if result.err != nil {
+					t.Errorf("Unexpected error: %s", result.err)
+				}
+				return
+			}
+			if result.err == nil {
+				t.Fatalf("Expected a %s error, got %s", tt.wantClass, reflect.TypeOf(result.obj))
+			}
+			if class := errorClass(result.err); class != tt.wantClass {
+				t.Errorf("Expected error class %s, got %s: %s", tt.wantClass, class, result.err)
+			}
+		})
+	}
+}
+
+func TestCollectCoalescedErrorsCountedOnce(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(500)
+	}))
+	defer server.Close()
+
+	module := config.DefaultModule
+	module.API = apiREST
+	c, err := newCollector(context.Background(), server.URL, &module, []string{"realtime"}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorCount := func() float64 {
+		m := &dto.Metric{}
+		sansayCollectorErrors.WithLabelValues("realtime", errorClassHTTPStatus).Write(m)
+		return m.GetCounter().GetValue()
+	}
+	before := errorCount()
+
 	var wg sync.WaitGroup
-	testCollector := collector{target: "http://localhost:8888/", username: "user", password: "pass", logger: log.NewNopLogger()}
+	collect := func() {
+		defer wg.Done()
+		found := false
+		for _, m := range gatherMetrics(c.Collect) {
+			if metricName(m) == "sansay_collector_error" {
+				found = true
+			}
+		}
+		if !found {
+			t.Error("Expected sansay_collector_error in every scrape")
+		}
+	}
+	wg.Add(2)
+	go collect()
+	waitInFlight(scrapes, c.scrapeKey())
+	go collect()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
 
-	type args struct {
-		c      collector
-		path   string
-		result chan interface{}
-		wg     *sync.WaitGroup
+	if got := errorCount() - before; got != 1 {
+		t.Errorf("Expected the error to be counted once, got %v", got)
 	}
+}
+
+func TestCollectorPaths(t *testing.T) {
+	for _, name := range config.Collectors {
+		if _, ok := collectorPaths[name]; !ok {
+			t.Errorf("No path for collector %s", name)
+		}
+	}
+	if len(collectorPaths) != len(config.Collectors) {
+		t.Errorf("Expected %d collector paths, got %d", len(config.Collectors), len(collectorPaths))
+	}
+}
+
+func TestProcessStatsPartial(t *testing.T) {
+	payload := `<mysqldump><database name="sansay"><table name="XBResourceRealTimeStatList">
+<row><field name="trunkId">100</field><field name="alias">carrier</field><field name="fqdn">Group</field>
+<field name="numOrig">3</field><field name="numTerm">bad</field><field name="cps">0</field><field name="numPeak">7</field>
+<field name="totalCLZ">0</field><field name="numCLZCps">0</field><field name="totalLimit">100</field><field name="cpsLimit">10</field></row>
+</table></database></mysqldump>`
+	for _, strict := range []bool{false, true} {
+		module := config.DefaultModule
+		module.Strict = strict
+		c := collector{module: &module, logger: log.NewNopLogger()}
+		ch := make(chan prometheus.Metric, 100)
+		if err := c.processStats(ch, strings.NewReader(payload)); err != nil {
+			t.Fatal(err)
+		}
+		close(ch)
+		valid, invalid := 0, 0
+		for m := range ch {
+			if err := m.Write(&dto.Metric{}); err != nil {
+				invalid++
+			} else {
+				valid++
+			}
+		}
+		if valid != len(realtimeMetrics)-1 {
+			t.Errorf("strict=%v: expected %d valid metrics, got %d", strict, len(realtimeMetrics)-1, valid)
+		}
+		if strict && invalid != 1 || !strict && invalid != 0 {
+			t.Errorf("strict=%v: unexpected number of invalid metrics: %d", strict, invalid)
+		}
+	}
+}
+
+func TestProcessStatsNodes(t *testing.T) {
+	payload := `<mysqldump><database name="sansay"><table name="XBResourceRealTimeStatList">
+<row><field name="trunkId">100</field><field name="alias">carrier</field><field name="fqdn">Group</field><field name="numOrig">3</field></row>
+<row><field name="trunkId">100</field><field name="alias">carrier</field><field name="fqdn">10.0.0.1</field><field name="numOrig">1</field></row>
+<row><field name="trunkId">100</field><field name="alias">carrier</field><field name="fqdn">10.0.0.2</field><field name="numOrig">2</field></row>
+</table></database></mysqldump>`
+	for _, nodes := range []bool{false, true} {
+		module := config.DefaultModule
+		module.RealtimeNodes = nodes
+		c := collector{module: &module, logger: log.NewNopLogger()}
+		got := map[string]float64{}
+		for _, m := range gatherMetrics(func(ch chan<- prometheus.Metric) {
+			if err := c.processStats(ch, strings.NewReader(payload)); err != nil {
+				t.Error(err)
+			}
+		}) {
+			if strings.HasSuffix(metricName(m), "_numorig") {
+				got[metricKey(t, m)] = metricValue(t, m)
+			}
+		}
+		want := map[string]float64{`sansay_trunk_numorig{alias="carrier",trunkgroup="100"}`: 3}
+		if nodes {
+			want[`sansay_trunk_numorig{alias="carrier",node="10.0.0.1",trunkgroup="100"}`] = 1
+			want[`sansay_trunk_numorig{alias="carrier",node="10.0.0.2",trunkgroup="100"}`] = 2
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("nodes=%v: got %v, want %v", nodes, got, want)
+		}
+	}
+}
+
+func TestCollectSimulator(t *testing.T) {
 	tests := []struct {
-		name     string
-		args     func(t *testing.T) args
-		httpMock httpmock.Responder
-		wantErr  bool
+		name  string
+		api   string
+		sim   simulator.Config
+		pages float64
 	}{
-		{ //TODO: Add test cases
-			name: "Test that errors are returned",
-			args: func(t *testing.T) args {
-				return args{
-					c:      testCollector,
-					path:   "",
-					result: make(chan interface{}),
-					wg:     &wg,
-				}
-			},
-			httpMock: httpmock.NewXmlResponderOrPanic(200, "<xml>response</xml>"),
-			wantErr:  true,
-		},
+		{name: "rest", api: apiREST, sim: simulator.Config{}},
+		{name: "soap", api: apiSOAP, sim: simulator.Config{PageSize: 30}, pages: 7},
+		{name: "auto", api: apiAuto, sim: simulator.Config{DisableREST: true}, pages: 1},
 	}
-
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tArgs := tt.args(t)
-			httpmock.Activate()
-			defer httpmock.DeactivateAndReset()
+			tt.sim.FixturesDir = "testdata"
+			tt.sim.Username = "user"
+			tt.sim.Password = "pass"
+			sim, err := simulator.New(tt.sim, log.NewNopLogger())
+			if err != nil {
+				t.Fatal(err)
+			}
+			server := httptest.NewServer(sim)
+			defer server.Close()
 
-			httpmock.RegisterResponder("GET", "http://localhost:8888/", tt.httpMock)
-			wg.Add(1)
-			go ScrapeTarget(tArgs.c, tArgs.path, tArgs.result, tArgs.wg)
-			result := <-tArgs.result
-			switch result.(type) {
-			case error:
-				if !tt.wantErr {
-					t.Errorf("Expected an error, received %s", reflect.TypeOf(result))
+			module := config.DefaultModule
+			module.API = tt.api
+			module.Collectors = config.Collectors
+			module.Username = "user"
+			module.Password = "pass"
+			c, err := newCollector(context.Background(), server.URL, &module, nil, log.NewNopLogger())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer apis.forget(c.apiKey())
+
+			pages := func() float64 {
+				m := &dto.Metric{}
+				downloadPages.WithLabelValues("resource", downloadPaged).Write(m)
+				return m.GetCounter().GetValue()
+			}
+			before := pages()
+			counts := map[string]int{}
+			for _, m := range gatherMetrics(c.Collect) {
+				counts[metricName(m)]++
+				if metricName(m) == "sansay_collector_error" {
+					t.Errorf("Collector failed: %s", m.Desc())
 				}
 			}
+			for name, want := range map[string]int{
+				"sansay_collector_success":         5,
+				"sansay_trunk_numorig":             200,
+				"sansay_trunk_calls_attempt":       0,
+				"sansay_trunk_day_calls":           1200,
+				"sansay_mediaserver_up":            8,
+				"sansay_config_trunk_sessions_max": 200,
+				"sansay_system_cpu_user_ratio":     3,
+				"sansay_system_memory_total_bytes": 1,
+				"sansay_system_disk_avail_bytes":   2,
+				"sansay_system_process_mem_bytes":  2,
+			} {
+				if counts[name] != want {
+					t.Errorf("Expected %d %s metrics, got %d", want, name, counts[name])
+				}
+			}
+			if got := pages() - before; got != tt.pages {
+				t.Errorf("Expected %v pages downloaded, got %v", tt.pages, got)
+			}
 		})
 	}
 }
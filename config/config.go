@@ -0,0 +1,431 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	configReloadSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "sansay_exporter",
+		Name:      "config_last_reload_successful",
+		Help:      "Sansay exporter config loaded successfully.",
+	})
+
+	configReloadSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "sansay_exporter",
+		Name:      "config_last_reload_success_timestamp_seconds",
+		Help:      "Timestamp of the last successful configuration reload.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(configReloadSuccess)
+	prometheus.MustRegister(configReloadSeconds)
+}
+
+// SafeConfig guards a Config that may be replaced while it is in use.
+type SafeConfig struct {
+	sync.RWMutex
+	C *Config
+}
+
+// Get returns the current configuration.
+func (sc *SafeConfig) Get() *Config {
+	sc.RLock()
+	defer sc.RUnlock()
+	return sc.C
+}
+
+// ReloadConfig loads the configuration file and swaps it in. The current
+// configuration is kept if the file cannot be loaded.
+func (sc *SafeConfig) ReloadConfig(confFile string) (err error) {
+	defer func() {
+		if err != nil {
+			configReloadSuccess.Set(0)
+		} else {
+			configReloadSuccess.Set(1)
+			configReloadSeconds.SetToCurrentTime()
+		}
+	}()
+
+	c, err := LoadFile(confFile)
+	if err != nil {
+		return fmt.Errorf("error loading config: %s", err)
+	}
+
+	sc.Lock()
+	sc.C = c
+	sc.Unlock()
+	return nil
+}
+
+// LoadFile reads and validates the exporter configuration file.
+func LoadFile(filename string) (*Config, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	err = yaml.UnmarshalStrict(content, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+var (
+	// Collectors lists the names of the sub-collectors that can be enabled.
+	Collectors = []string{"realtime", "resource", "media_server", "resource_config", "system"}
+
+	// DefaultCollectors are the sub-collectors enabled in modules that do not
+	// list theirs. The system collector is left out, as not every SBC offers
+	// system statistics.
+	DefaultCollectors = []string{"realtime", "resource", "media_server", "resource_config"}
+
+	// TrunkInfoLabels lists the resource configuration fields that can be
+	// added as labels to sansay_trunk_info.
+	TrunkInfoLabels = []string{
+		"protocol", "port_address", "direction", "service_state", "nat",
+		"allow_direct_media", "sip_profile_index", "option_poll", "company_name",
+		"sg_id", "rtid", "dtid", "codec_policy", "group_policy", "tech_prefix",
+		"cause_code_profile", "stop_route_profile",
+	}
+
+	// DefaultTrunkInfoLabels are the labels of sansay_trunk_info in modules
+	// that do not list theirs.
+	DefaultTrunkInfoLabels = []string{"protocol", "direction", "company_name"}
+
+	// DefaultModule holds the settings applied to every module before its own
+	// values are read from the configuration file.
+	DefaultModule = Module{
+		Protocol:        "https",
+		API:             "auto",
+		APIDetectionTTL: time.Hour,
+		RestPath:        "/SSConfig/webresources/",
+		SoapPath:        "/SSConfig/SansayWS",
+		Collectors:      DefaultCollectors,
+		TrunkInfoLabels: DefaultTrunkInfoLabels,
+		// Like --sansay.max-queued-requests, so that setting only
+		// max_concurrent_requests queues requests rather than rejecting them.
+		MaxQueuedRequests: 100,
+	}
+)
+
+// ValidCollector reports whether name is a known sub-collector.
+func ValidCollector(name string) bool {
+	for _, c := range Collectors {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+func validTrunkInfoLabel(name string) bool {
+	for _, l := range TrunkInfoLabels {
+		if l == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Config is the top level of the configuration file.
+type Config struct {
+	Modules map[string]*Module `yaml:"modules"`
+	// Targets polled in the background. Scrapes of these targets are served
+	// from the latest results instead of querying the SBC.
+	Poll []*PollTarget `yaml:"poll,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Config
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if len(c.Modules) == 0 {
+		return fmt.Errorf("no modules defined")
+	}
+	for name, module := range c.Modules {
+		if module == nil {
+			return fmt.Errorf("module %q is empty", name)
+		}
+		module.Name = name
+	}
+	seen := make(map[string]bool, len(c.Poll))
+	for _, pt := range c.Poll {
+		if pt == nil {
+			return fmt.Errorf("empty poll target")
+		}
+		if _, ok := c.Modules[pt.Module]; !ok {
+			return fmt.Errorf("poll target %q uses unknown module %q", pt.Target, pt.Module)
+		}
+		key := pt.Target + "/" + pt.Module
+		if seen[key] {
+			return fmt.Errorf("poll target %q with module %q defined more than once", pt.Target, pt.Module)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// DefaultPollIntervals are the intervals at which each sub-collector of a
+// polled target is run, unless the poll target overrides them.
+var DefaultPollIntervals = map[string]time.Duration{
+	"realtime":        15 * time.Second,
+	"resource":        time.Minute,
+	"media_server":    time.Minute,
+	"resource_config": 10 * time.Minute,
+	"system":          time.Minute,
+}
+
+// PollTarget is an SBC that the exporter polls in the background.
+type PollTarget struct {
+	Target    string                   `yaml:"target"`
+	Module    string                   `yaml:"module,omitempty"`
+	Intervals map[string]time.Duration `yaml:"intervals,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *PollTarget) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain PollTarget
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.Target == "" {
+		return fmt.Errorf("poll target must have a target")
+	}
+	if c.Module == "" {
+		c.Module = "default"
+	}
+	for name, interval := range c.Intervals {
+		if !ValidCollector(name) {
+			return fmt.Errorf("unknown collector %q in intervals of poll target %q", name, c.Target)
+		}
+		if interval <= 0 {
+			return fmt.Errorf("interval of collector %q for poll target %q must be positive", name, c.Target)
+		}
+	}
+	return nil
+}
+
+// Interval returns how often the named sub-collector is run for the target.
+func (c *PollTarget) Interval(collector string) time.Duration {
+	if interval, ok := c.Intervals[collector]; ok {
+		return interval
+	}
+	return DefaultPollIntervals[collector]
+}
+
+// Module describes how to reach and authenticate against a Sansay SBC.
+type Module struct {
+	// The name of the module in the configuration file.
+	Name string `yaml:"-"`
+
+	Username string `yaml:"username"`
+	Password Secret `yaml:"password"`
+	Protocol string `yaml:"protocol,omitempty"`
+	// The API used to query the SBC: rest, soap, or auto to detect it.
+	API string `yaml:"api,omitempty"`
+	// How long a detected API is remembered before probing the SBC again.
+	APIDetectionTTL time.Duration `yaml:"api_detection_ttl,omitempty"`
+	RestPath        string        `yaml:"rest_path,omitempty"`
+	SoapPath        string        `yaml:"soap_path,omitempty"`
+	// Upper bound on the time spent scraping the SBC; the Prometheus scrape
+	// timeout is used when it is shorter.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// The sub-collectors run for a scrape unless the request selects fewer.
+	Collectors []string `yaml:"collectors,omitempty"`
+	// Fail the whole scrape when a sub-collector fails or a field cannot be
+	// parsed, instead of serving the metrics that could be collected.
+	Strict bool `yaml:"strict,omitempty"`
+	// Export the realtime statistics of each node of multi-node trunks,
+	// besides those of the whole trunk.
+	RealtimeNodes bool `yaml:"realtime_nodes,omitempty"`
+	// The resource configuration fields added as labels to sansay_trunk_info.
+	TrunkInfoLabels []string `yaml:"trunk_info_labels,omitempty"`
+	// Limit the requests in flight to each target of the module; further
+	// requests wait in a queue of bounded size. 0 means no limit.
+	MaxConcurrentRequests int `yaml:"max_concurrent_requests,omitempty"`
+	MaxQueuedRequests     int `yaml:"max_queued_requests,omitempty"`
+
+	TLSConfig TLSConfig `yaml:"tls_config,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *Module) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultModule
+	type plain Module
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	c.Protocol = strings.ToLower(c.Protocol)
+	switch c.Protocol {
+	case "http", "https":
+	default:
+		return fmt.Errorf("invalid protocol %q, must be http or https", c.Protocol)
+	}
+	c.API = strings.ToLower(c.API)
+	switch c.API {
+	case "rest", "soap", "auto":
+	default:
+		return fmt.Errorf("invalid api %q, must be rest, soap or auto", c.API)
+	}
+	if c.APIDetectionTTL <= 0 {
+		return fmt.Errorf("invalid api_detection_ttl %s, must be positive", c.APIDetectionTTL)
+	}
+	if len(c.Collectors) == 0 {
+		return fmt.Errorf("no collectors enabled")
+	}
+	for _, name := range c.Collectors {
+		if !ValidCollector(name) {
+			return fmt.Errorf("unknown collector %q", name)
+		}
+	}
+	seen := map[string]bool{}
+	for _, name := range c.TrunkInfoLabels {
+		if !validTrunkInfoLabel(name) {
+			return fmt.Errorf("unknown trunk info label %q", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("trunk info label %q listed more than once", name)
+		}
+		seen[name] = true
+	}
+	if c.MaxConcurrentRequests < 0 || c.MaxQueuedRequests < 0 {
+		return fmt.Errorf("request limits must not be negative")
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("invalid timeout %s, must not be negative", c.Timeout)
+	}
+	if !strings.HasSuffix(c.RestPath, "/") {
+		c.RestPath += "/"
+	}
+	if _, err := NewTLSConfig(&c.TLSConfig); err != nil {
+		return err
+	}
+	return nil
+}
+
+// TLSConfig configures the TLS connection to the SBC.
+type TLSConfig struct {
+	// The CA bundle used to verify the SBC certificate.
+	CAFile string `yaml:"ca_file,omitempty"`
+	// The client certificate and key for mutual TLS.
+	CertFile string `yaml:"cert_file,omitempty"`
+	KeyFile  string `yaml:"key_file,omitempty"`
+	// Used to verify the hostname on the SBC certificate.
+	ServerName string `yaml:"server_name,omitempty"`
+	// Disable verification of the SBC certificate.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+	// The lowest TLS version accepted.
+	MinVersion TLSVersion `yaml:"min_version,omitempty"`
+}
+
+// NewTLSConfig creates a new tls.Config from the given TLSConfig.
+func NewTLSConfig(cfg *TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		ServerName:         cfg.ServerName,
+		MinVersion:         uint16(cfg.MinVersion),
+	}
+
+	if len(cfg.CAFile) > 0 {
+		b, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load specified CA cert %s: %s", cfg.CAFile, err)
+		}
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("unable to use specified CA cert %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = caCertPool
+	}
+
+	if len(cfg.CertFile) > 0 && len(cfg.KeyFile) == 0 {
+		return nil, fmt.Errorf("client cert file %q specified without client key file", cfg.CertFile)
+	} else if len(cfg.KeyFile) > 0 && len(cfg.CertFile) == 0 {
+		return nil, fmt.Errorf("client key file %q specified without client cert file", cfg.KeyFile)
+	} else if len(cfg.CertFile) > 0 && len(cfg.KeyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to use specified client cert (%s) & key (%s): %s", cfg.CertFile, cfg.KeyFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// TLSVersion is a TLS protocol version that can be given by name in the
+// configuration file.
+type TLSVersion uint16
+
+var tlsVersions = map[string]TLSVersion{
+	"TLS13": (TLSVersion)(tls.VersionTLS13),
+	"TLS12": (TLSVersion)(tls.VersionTLS12),
+	"TLS11": (TLSVersion)(tls.VersionTLS11),
+	"TLS10": (TLSVersion)(tls.VersionTLS10),
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (v *TLSVersion) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	if version, ok := tlsVersions[strings.ToUpper(s)]; ok {
+		*v = version
+		return nil
+	}
+	return fmt.Errorf("unknown TLS version: %s", s)
+}
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (v TLSVersion) MarshalYAML() (interface{}, error) {
+	for name, version := range tlsVersions {
+		if version == v {
+			return name, nil
+		}
+	}
+	return nil, nil
+}
+
+// Secret is a string that must not be revealed on marshaling.
+type Secret string
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (s Secret) MarshalYAML() (interface{}, error) {
+	if s != "" {
+		return "<secret>", nil
+	}
+	return nil, nil
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (s *Secret) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Secret
+	return unmarshal((*plain)(s))
+}
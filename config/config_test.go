@@ -0,0 +1,83 @@
+package config
+
+import (
+	"crypto/tls"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestLoadFile(t *testing.T) {
+	cfg, err := LoadFile("testdata/valid.yml")
+	if err != nil {
+		t.Fatalf("Error loading config: %s", err)
+	}
+	def := cfg.Modules["default"]
+	if def.Protocol != "https" || def.API != "auto" || def.RestPath != DefaultModule.RestPath || def.MaxQueuedRequests != 100 || def.Name != "default" {
+		t.Errorf("Defaults not applied to module: %+v", def)
+	}
+	legacy := cfg.Modules["legacy"]
+	if legacy.Protocol != "http" || legacy.API != "soap" || legacy.SoapPath != "/SansayWS" || len(legacy.TrunkInfoLabels) != 2 {
+		t.Errorf("Module values not read: %+v", legacy)
+	}
+	tlsConfig, err := NewTLSConfig(&legacy.TLSConfig)
+	if err != nil {
+		t.Fatalf("Error creating TLS config: %s", err)
+	}
+	if !tlsConfig.InsecureSkipVerify || tlsConfig.ServerName != "sbc.example.com" || tlsConfig.MinVersion != tls.VersionTLS12 {
+		t.Errorf("TLS settings not applied: %+v", legacy.TLSConfig)
+	}
+	poll := cfg.Poll[0]
+	if poll.Module != "default" || poll.Interval("realtime") != 5*time.Second || poll.Interval("resource_config") != DefaultPollIntervals["resource_config"] {
+		t.Errorf("Poll target not read: %+v", poll)
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		file string
+		want string
+	}{
+		{file: "testdata/invalid-api.yml", want: "invalid api"},
+		{file: "testdata/unknown-field.yml", want: "field user not found"},
+		{file: "testdata/missing.yml", want: "no such file"},
+		{file: "testdata/cert-without-key.yml", want: "without client key file"},
+		{file: "testdata/invalid-tls-version.yml", want: "unknown TLS version"},
+		{file: "testdata/poll-unknown-module.yml", want: "unknown module"},
+		{file: "testdata/unknown-trunk-info-label.yml", want: "unknown trunk info label"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			_, err := LoadFile(tt.file)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestSecretNotMarshaled(t *testing.T) {
+	out, err := yaml.Marshal(Module{Username: "user", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "secret\n") {
+		t.Errorf("Password revealed in marshaled module: %s", out)
+	}
+}
+
+func TestReloadConfigKeepsPrevious(t *testing.T) {
+	sc := &SafeConfig{}
+	if err := sc.ReloadConfig("testdata/valid.yml"); err != nil {
+		t.Fatalf("Error loading config: %s", err)
+	}
+	previous := sc.Get()
+	if err := sc.ReloadConfig("testdata/invalid-api.yml"); err == nil {
+		t.Fatal("Expected an error reloading an invalid config")
+	}
+	if sc.Get() != previous {
+		t.Error("Config was replaced by an invalid file")
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2016 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxDownloadPages bounds the pages requested for one table before the large
+// download is used instead.
+const maxDownloadPages = 100
+
+// Methods used to download a table over SOAP.
+const (
+	downloadPaged = "paged"
+	downloadLarge = "large"
+)
+
+var downloadPages = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "sansay_download_pages_total",
+		Help: "Pages of configuration tables downloaded from Sansay targets over SOAP",
+	},
+	[]string{"table", "method"},
+)
+
+func init() {
+	prometheus.MustRegister(downloadPages)
+}
+
+// downloadResources downloads the resource table page by page. The first page
+// is returned as the SBC sent it, with the XBResource elements of the
+// following pages inserted before its end tag. If the table cannot be
+// downloaded in pages, it is downloaded in one piece with
+// DoDownloadLargeXmlFile.
+func downloadResources(ctx context.Context, c collector, service SansayWS, path string) ([]byte, error) {
+	var (
+		first     []byte
+		more      bytes.Buffer
+		resources int
+	)
+	for page := int32(0); ; page++ {
+		if page == maxDownloadPages {
+			level.Warn(c.logger).Log("msg", "Too many pages, downloading the table at once", "path", path, "pages", page)
+			return downloadLargeTable(ctx, c, service, path, "resource")
+		}
+		reply, err := service.DoDownloadXmlFileContext(ctx, &DownloadParams{
+			Username: c.module.Username,
+			Password: string(c.module.Password),
+			Page:     page,
+			Table:    "resource",
+		})
+		if err != nil {
+			return nil, soapCallError(c, path, err)
+		}
+		if reply.RetCode != 0 {
+			level.Warn(c.logger).Log("msg", "Paged download failed, downloading the table at once", "path", path, "page", page, "ret_code", reply.RetCode, "sbc_msg", reply.Msg)
+			return downloadLargeTable(ctx, c, service, path, "resource")
+		}
+		downloadPages.WithLabelValues("resource", downloadPaged).Inc()
+
+		if len(bytes.TrimSpace([]byte(reply.Xmlfile))) == 0 {
+			if page == 0 {
+				level.Error(c.logger).Log("msg", "Empty payload from SOAP API", "path", path)
+				return nil, &emptyPayloadError{}
+			}
+		} else {
+			elements, err := rawElements([]byte(reply.Xmlfile), "XBResource")
+			if err != nil {
+				level.Error(c.logger).Log("msg", "Error parsing XML", "path", path, "page", page, "err", err)
+				return nil, &parseError{err: err}
+			}
+			if page == 0 {
+				first = []byte(reply.Xmlfile)
+			} else {
+				for _, element := range elements {
+					more.Write(element)
+				}
+			}
+			resources += len(elements)
+		}
+		if reply.HasMore == 0 {
+			level.Debug(c.logger).Log("msg", "Downloaded table", "path", path, "pages", page+1, "resources", resources)
+			break
+		}
+	}
+	if more.Len() == 0 {
+		return first, nil
+	}
+	end := bytes.LastIndex(first, []byte("</"))
+	if end < 0 {
+		level.Error(c.logger).Log("msg", "No end tag in the first page", "path", path)
+		return nil, &parseError{err: fmt.Errorf("no end tag in the first page of %s", path)}
+	}
+	merged := make([]byte, 0, len(first)+more.Len())
+	merged = append(merged, first[:end]...)
+	merged = append(merged, more.Bytes()...)
+	return append(merged, first[end:]...), nil
+}
+
+// downloadLargeTable downloads a whole table with DoDownloadLargeXmlFile.
+func downloadLargeTable(ctx context.Context, c collector, service SansayWS, path, table string) ([]byte, error) {
+	reply, err := service.DoDownloadLargeXmlFileContext(ctx, &DownloadLargeParams{
+		Username: c.module.Username,
+		Password: string(c.module.Password),
+		Table:    table,
+	})
+	if err != nil {
+		return nil, soapCallError(c, path, err)
+	}
+	if reply.RetCode != 0 {
+		return nil, soapRetCodeError(c, path, reply.RetCode, reply.Msg)
+	}
+	downloadPages.WithLabelValues(table, downloadLarge).Inc()
+	body, err := decodeBinfile(reply.Binfile)
+	if err != nil {
+		level.Error(c.logger).Log("msg", "Error decoding large download", "path", path, "err", err)
+		return nil, &parseError{err: err}
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		level.Error(c.logger).Log("msg", "Empty payload from SOAP API", "path", path)
+		return nil, &emptyPayloadError{}
+	}
+	return body, nil
+}
+
+// decodeBinfile returns the XML carried base64 encoded, and possibly gzipped,
+// in the binfile of a large download.
+func decodeBinfile(binfile []byte) ([]byte, error) {
+	binfile = bytes.TrimSpace(binfile)
+	data := make([]byte, base64.StdEncoding.DecodedLen(len(binfile)))
+	n, err := base64.StdEncoding.Decode(data, binfile)
+	if err != nil {
+		return nil, err
+	}
+	data = data[:n]
+	if len(data) > 1 && data[0] == 0x1f && data[1] == 0x8b {
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		data, err = ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/ringsq/sansay_exporter/config"
+)
+
+var soapPageRE = regexp.MustCompile(`<page>(\d+)</page>`)
+
+func resourcePage(names ...string) string {
+	page := "<XBResourceList>"
+	for _, name := range names {
+		page += fmt.Sprintf("<XBResource><name>%s</name></XBResource>", name)
+	}
+	return page + "</XBResourceList>"
+}
+
+func soapDownloadResponse(retCode, hasMore int, xmlfile string) string {
+	return fmt.Sprintf(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>
+<ns2:downloadResult xmlns:ns2="http://ws.sansay.com"><retCode>%d</retCode><msg>msg</msg><xmlfile>%s</xmlfile><hasMore>%d</hasMore></ns2:downloadResult>
+</soap:Body></soap:Envelope>`, retCode, html.EscapeString(xmlfile), hasMore)
+}
+
+func soapCollector(t *testing.T, handler http.HandlerFunc) (collector, func()) {
+	server := httptest.NewServer(handler)
+	module := config.DefaultModule
+	module.API = apiSOAP
+	c, err := newCollector(context.Background(), server.URL, &module, nil, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, server.Close
+}
+
+func TestDownloadResourcesPaged(t *testing.T) {
+	// Elements unknown to the exporter are kept as they are.
+	unknown := "<XBResource><name>c</name><futureField>1</futureField></XBResource>"
+	pages := []string{resourcePage("a", "b"), "<XBResourceList>" + unknown + "</XBResourceList>", resourcePage("d")}
+	c, stop := soapCollector(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		page := 0
+		if m := soapPageRE.FindSubmatch(body); m != nil {
+			fmt.Sscan(string(m[1]), &page)
+		}
+		hasMore := 0
+		if page < len(pages)-1 {
+			hasMore = 1
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(soapDownloadResponse(0, hasMore, pages[page])))
+	})
+	defer stop()
+
+	body, err := callSoapAPI(context.Background(), c, "download/resource")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<XBResourceList><XBResource><name>a</name></XBResource><XBResource><name>b</name></XBResource>" +
+		unknown + "<XBResource><name>d</name></XBResource></XBResourceList>"
+	if string(body) != want {
+		t.Errorf("Unexpected merged resources %s", body)
+	}
+}
+
+func TestDownloadResourcesLarge(t *testing.T) {
+	binfile := base64.StdEncoding.EncodeToString([]byte(resourcePage("large")))
+	c, stop := soapCollector(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/xml")
+		if bytes.Contains(body, []byte("downloadLargeParams")) {
+			fmt.Fprintf(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>
+<ns2:downloadLargeResult xmlns:ns2="http://ws.sansay.com"><retCode>0</retCode><binfile>%s</binfile></ns2:downloadLargeResult>
+</soap:Body></soap:Envelope>`, binfile)
+			return
+		}
+		w.Write([]byte(soapDownloadResponse(1, 0, "")))
+	})
+	defer stop()
+
+	body, err := callSoapAPI(context.Background(), c, "download/resource")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != resourcePage("large") {
+		t.Errorf("Unexpected large download %q", body)
+	}
+}
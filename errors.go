@@ -0,0 +1,129 @@
+// Copyright 2016 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/hooklift/gowsdl/soap"
+)
+
+// Error classes used to label failed sub-collectors.
+const (
+	errorClassTimeout    = "timeout"
+	errorClassAuth       = "auth"
+	errorClassHTTPStatus = "http_status"
+	errorClassParse      = "parse"
+	errorClassSOAPFault  = "soap_fault"
+	errorClassRetCode    = "ret_code"
+	errorClassEmpty      = "empty_payload"
+	errorClassTransport  = "transport"
+	errorClassRejected   = "rejected"
+	errorClassOther      = "other"
+)
+
+// httpStatusError is returned when the SBC answers a REST request with an
+// unexpected status code.
+type httpStatusError struct {
+	code int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("Invalid response from server: %d", e.code)
+}
+
+// parseError is returned when the payload returned by the SBC cannot be decoded.
+type parseError struct {
+	err error
+}
+
+func (e *parseError) Error() string {
+	return fmt.Sprintf("Error parsing XML: %s", e.err)
+}
+
+func (e *parseError) Unwrap() error {
+	return e.err
+}
+
+// transportError is returned when a request to the SBC fails before a
+// complete response is received.
+type transportError struct {
+	err error
+}
+
+func (e *transportError) Error() string {
+	return e.err.Error()
+}
+
+func (e *transportError) Unwrap() error {
+	return e.err
+}
+
+// retCodeError is returned when the SBC answers a SOAP call with a non-zero
+// return code.
+type retCodeError struct {
+	code int32
+	msg  string
+}
+
+func (e *retCodeError) Error() string {
+	return fmt.Sprintf("SOAP API returned code %d: %s", e.code, e.msg)
+}
+
+// emptyPayloadError is returned when the SBC answers a SOAP call without any data.
+type emptyPayloadError struct{}
+
+func (e *emptyPayloadError) Error() string {
+	return "SOAP API returned an empty payload"
+}
+
+// errorClass returns the class of a scrape error, used as a metric label.
+func errorClass(err error) string {
+	var statusErr *httpStatusError
+	var fault *soap.SOAPFault
+	var parseErr *parseError
+	var queueErr *queueFullError
+	var retCodeErr *retCodeError
+	var emptyErr *emptyPayloadError
+	var transportErr *transportError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return errorClassTimeout
+	case errors.As(err, &statusErr):
+		if statusErr.code == http.StatusUnauthorized || statusErr.code == http.StatusForbidden {
+			return errorClassAuth
+		}
+		return errorClassHTTPStatus
+	case errors.As(err, &fault):
+		return errorClassSOAPFault
+	case errors.As(err, &parseErr):
+		return errorClassParse
+	case errors.As(err, &retCodeErr):
+		return errorClassRetCode
+	case errors.As(err, &emptyErr):
+		return errorClassEmpty
+	case errors.As(err, &queueErr):
+		return errorClassRejected
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return errorClassTimeout
+	case errors.As(err, &transportErr):
+		return errorClassTransport
+	}
+	return errorClassOther
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/hooklift/gowsdl/soap"
+)
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{err: &url.Error{Op: "Get", URL: "http://sbc", Err: context.DeadlineExceeded}, want: errorClassTimeout},
+		{err: &httpStatusError{code: 401}, want: errorClassAuth},
+		{err: &httpStatusError{code: 500}, want: errorClassHTTPStatus},
+		{err: &soap.SOAPFault{Code: "soap:Server"}, want: errorClassSOAPFault},
+		{err: &parseError{err: &xml.SyntaxError{Msg: "unexpected EOF"}}, want: errorClassParse},
+		{err: fmt.Errorf("wrapped: %w", &httpStatusError{code: 403}), want: errorClassAuth},
+		{err: &retCodeError{code: 1, msg: "Invalid user"}, want: errorClassRetCode},
+		{err: &emptyPayloadError{}, want: errorClassEmpty},
+		{err: &transportError{err: errors.New("connection refused")}, want: errorClassTransport},
+		{err: &transportError{err: &url.Error{Op: "Post", URL: "http://sbc", Err: context.DeadlineExceeded}}, want: errorClassTimeout},
+		{err: errors.New("connection refused"), want: errorClassOther},
+	}
+	for _, tt := range tests {
+		if got := errorClass(tt.err); got != tt.want {
+			t.Errorf("errorClass(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
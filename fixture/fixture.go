@@ -0,0 +1,24 @@
+// Copyright 2016 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fixture names the files holding the payloads of the SBC APIs, as
+// recorded by the exporter and served by the simulator and replay mode.
+package fixture
+
+import "strings"
+
+// File returns the name of the file holding the payload of an API path, e.g.
+// stats_realtime.xml for stats/realtime.
+func File(path string) string {
+	return strings.Replace(strings.Trim(path, "/"), "/", "_", -1) + ".xml"
+}
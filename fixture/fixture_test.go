@@ -0,0 +1,14 @@
+package fixture
+
+import "testing"
+
+func TestFile(t *testing.T) {
+	for path, want := range map[string]string{
+		"stats/realtime":     "stats_realtime.xml",
+		"/download/resource": "download_resource.xml",
+	} {
+		if got := File(path); got != want {
+			t.Errorf("File(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
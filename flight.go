@@ -0,0 +1,100 @@
+// Copyright 2016 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// scrapeOutcome is what a scrape of a target produced. The metrics are
+// created once by the caller that ran the scrape and replayed to the callers
+// that waited for it.
+type scrapeOutcome struct {
+	metrics []prometheus.Metric
+	up      bool
+	expiry  time.Time
+}
+
+type scrapeCall struct {
+	done    chan struct{}
+	outcome scrapeOutcome
+	cancel  context.CancelFunc
+	// The callers still waiting for the outcome.
+	waiters int
+}
+
+// scrapeGroup coalesces identical scrapes that are in flight at the same time,
+// so the target is only queried once.
+type scrapeGroup struct {
+	mtx   sync.Mutex
+	calls map[string]*scrapeCall
+}
+
+func newScrapeGroup() *scrapeGroup {
+	return &scrapeGroup{calls: map[string]*scrapeCall{}}
+}
+
+// Do runs fn unless a scrape with the same key is already running, in which
+// case it joins that scrape. The scrape does not belong to any caller: it runs
+// under its own context, bounded by timeout when positive and cancelled once
+// every caller has given up. Each caller waits until its own ctx is done.
+// shared reports whether the caller joined another caller's scrape.
+func (g *scrapeGroup) Do(ctx context.Context, key string, timeout time.Duration, fn func(ctx context.Context) scrapeOutcome) (outcome scrapeOutcome, shared bool, err error) {
+	g.mtx.Lock()
+	call, shared := g.calls[key]
+	if !shared {
+		scrapeCtx, cancel := context.WithCancel(context.Background())
+		if timeout > 0 {
+			scrapeCtx, cancel = context.WithTimeout(context.Background(), timeout)
+		}
+		call = &scrapeCall{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = call
+		go func() {
+			call.outcome = fn(scrapeCtx)
+			g.mtx.Lock()
+			g.forget(key, call)
+			g.mtx.Unlock()
+			cancel()
+			close(call.done)
+		}()
+	}
+	call.waiters++
+	g.mtx.Unlock()
+
+	select {
+	case <-call.done:
+		return call.outcome, shared, nil
+	case <-ctx.Done():
+		g.mtx.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			// Nobody wants the outcome anymore, later callers start afresh.
+			call.cancel()
+			g.forget(key, call)
+		}
+		g.mtx.Unlock()
+		return scrapeOutcome{}, shared, ctx.Err()
+	}
+}
+
+// forget removes call unless it was already replaced. g.mtx must be held.
+func (g *scrapeGroup) forget(key string, call *scrapeCall) {
+	if g.calls[key] == call {
+		delete(g.calls, key)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScrapeGroupCoalesces(t *testing.T) {
+	g := newScrapeGroup()
+	release := make(chan struct{})
+	calls := 0
+	fn := func(context.Context) scrapeOutcome {
+		calls++
+		<-release
+		return scrapeOutcome{up: true}
+	}
+
+	var wg sync.WaitGroup
+	shared := make(chan bool, 2)
+	scrape := func() {
+		defer wg.Done()
+		outcome, s, err := g.Do(context.Background(), "key", 0, fn)
+		if err != nil || !outcome.up {
+			t.Errorf("Unexpected outcome %+v, err %v", outcome, err)
+		}
+		shared <- s
+	}
+	wg.Add(2)
+	go scrape()
+	waitInFlight(g, "key")
+	go scrape()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(shared)
+
+	if calls != 1 {
+		t.Errorf("Expected the scrape to run once, ran %d times", calls)
+	}
+	sharedCount := 0
+	for s := range shared {
+		if s {
+			sharedCount++
+		}
+	}
+	if sharedCount != 1 {
+		t.Errorf("Expected one coalesced scrape, got %d", sharedCount)
+	}
+}
+
+func TestScrapeGroupWaiterGivesUp(t *testing.T) {
+	g := newScrapeGroup()
+	release := make(chan struct{})
+	type doResult struct {
+		outcome scrapeOutcome
+		shared  bool
+		err     error
+	}
+	do := func(ctx context.Context, results chan<- doResult) {
+		outcome, shared, err := g.Do(ctx, "key", 0, func(ctx context.Context) scrapeOutcome {
+			<-release
+			return scrapeOutcome{up: ctx.Err() == nil}
+		})
+		results <- doResult{outcome, shared, err}
+	}
+	first, second := make(chan doResult), make(chan doResult)
+	ctx, cancel := context.WithCancel(context.Background())
+	go do(ctx, first)
+	waitInFlight(g, "key")
+	go do(context.Background(), second)
+	for {
+		g.mtx.Lock()
+		waiters := g.calls["key"].waiters
+		g.mtx.Unlock()
+		if waiters == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The caller that started the scrape gives up, the scrape goes on for
+	// the one that joined it.
+	cancel()
+	if r := <-first; r.shared || r.err != context.Canceled {
+		t.Errorf("Expected the first caller to give up, got shared=%v err=%v", r.shared, r.err)
+	}
+	close(release)
+	if r := <-second; !r.shared || r.err != nil || !r.outcome.up {
+		t.Errorf("Expected the outcome of the scrape, got %+v shared=%v err=%v", r.outcome, r.shared, r.err)
+	}
+}
+
+func TestScrapeGroupCancelsAbandonedScrape(t *testing.T) {
+	g := newScrapeGroup()
+	cancelled := make(chan struct{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, _, err := g.Do(ctx, "key", 0, func(ctx context.Context) scrapeOutcome {
+		<-ctx.Done()
+		close(cancelled)
+		return scrapeOutcome{}
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected the caller to time out, got %v", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Scrape not cancelled once no caller waited for it")
+	}
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	if len(g.calls) != 0 {
+		t.Errorf("Expected the abandoned scrape to be forgotten, got %d", len(g.calls))
+	}
+}
+
+// waitInFlight waits until a scrape with the key is running.
+func waitInFlight(g *scrapeGroup, key string) {
+	for {
+		g.mtx.Lock()
+		_, ok := g.calls[key]
+		g.mtx.Unlock()
+		if ok {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
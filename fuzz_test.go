@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/ringsq/sansay_exporter/config"
+	"github.com/ringsq/sansay_exporter/models"
+)
+
+func addFuzzSeeds(f *testing.F, files ...string) {
+	for _, file := range files {
+		f.Add(readFixture(f, filepath.Join("golden", "fixtures", file)))
+	}
+}
+
+func fuzzCollectors() []collector {
+	var collectors []collector
+	for _, strict := range []bool{false, true} {
+		module := config.DefaultModule
+		module.Strict = strict
+		module.RealtimeNodes = strict
+		collectors = append(collectors, collector{module: &module, logger: log.NewNopLogger()})
+	}
+	return collectors
+}
+
+// FuzzProcessStats checks that no statistics payload makes the exporter panic.
+func FuzzProcessStats(f *testing.F) {
+	addFuzzSeeds(f, "stats_realtime.xml", "stats_resource.xml")
+	f.Add([]byte(`<mysqldump><database><table name="system_stat"><row><field name="">1</field><field name="cpu-load">1</field></row></table></database></mysqldump>`))
+	f.Add([]byte(`<mysqldump><database><table name="gw_egress_stat"><row><field name="trunk_id">1</field><field name="24h_call_fail">x</field></row></table></database></mysqldump>`))
+	f.Add([]byte(`<mysqldump><database><table name="disk_stat"><row><field name="mount">/</field><field name="used-kb">1</field><field name="avail_kb">x</field></row></table></database></mysqldump>`))
+	collectors := fuzzCollectors()
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, c := range collectors {
+			gatherMetrics(func(ch chan<- prometheus.Metric) { c.processStats(ch, bytes.NewReader(data)) })
+		}
+	})
+}
+
+// FuzzProcessMedia checks that no media server payload makes the exporter panic.
+func FuzzProcessMedia(f *testing.F) {
+	addFuzzSeeds(f, "stats_media_server.xml")
+	collectors := fuzzCollectors()
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var media XBMediaServerRealTimeStatList
+		if err := xml.Unmarshal(data, &media); err != nil {
+			return
+		}
+		for _, c := range collectors {
+			gatherMetrics(func(ch chan<- prometheus.Metric) { c.processMediaCollection(ch, media) })
+		}
+	})
+}
+
+// FuzzProcessXBResourceList checks that no resource configuration payload
+// makes the exporter panic.
+func FuzzProcessXBResourceList(f *testing.F) {
+	addFuzzSeeds(f, "download_resource.xml")
+	collectors := fuzzCollectors()
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var resources models.XBResourceList
+		if err := xml.Unmarshal(data, &resources); err != nil {
+			return
+		}
+		for _, c := range collectors {
+			gatherMetrics(func(ch chan<- prometheus.Metric) { c.processXBResourceList(ch, resources) })
+		}
+	})
+}
+
+// FuzzDecodeBinfile checks that no large download makes the exporter panic.
+func FuzzDecodeBinfile(f *testing.F) {
+	f.Add([]byte("PFhCUmVzb3VyY2VMaXN0Lz4="))
+	f.Add([]byte("H4sIAAAAAAAA/7KJqHAKSi3OLy1KTtW3AwQAAP//fPqHkBAAAAA="))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		decodeBinfile(data)
+	})
+}
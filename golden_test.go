@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/ringsq/sansay_exporter/config"
+)
+
+var update = flag.Bool("update", false, "Update the golden files of TestHandlerGolden.")
+
+// volatileMetrics are left out of the golden files as their values change
+// with every scrape or build.
+var volatileMetrics = []string{
+	"sansay_scrape_duration_seconds",
+	"sansay_collector_duration_seconds",
+	"sansay_exporter_build_info",
+}
+
+// TestHandlerGolden runs the /sansay handler against the payloads in
+// testdata/golden/fixtures and compares the exposition with the golden files.
+// Run with -update to regenerate them after an intended change.
+func TestHandlerGolden(t *testing.T) {
+	replayDir = filepath.Join("testdata", "golden", "fixtures")
+	defer func() { replayDir = "" }()
+
+	module := config.DefaultModule
+	sc := &config.SafeConfig{C: &config.Config{Modules: map[string]*config.Module{"default": &module}}}
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{name: "all", query: "target=sbc1"},
+		{name: "media_server", query: "target=sbc1&collect[]=media_server"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/sansay?"+tt.query, nil)
+			handler(rec, req, log.NewNopLogger(), sc, newPoller(log.NewNopLogger()))
+			if rec.Code != 200 {
+				t.Fatalf("Unexpected status %d: %s", rec.Code, rec.Body)
+			}
+			got := stableExposition(rec.Body.Bytes())
+
+			golden := filepath.Join("testdata", "golden", tt.name+".prom")
+			if *update {
+				if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%s (run with -update to create it)", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("Exposition differs from %s, run with -update if the change is intended:\n%s", golden, diffLines(want, got))
+			}
+		})
+	}
+}
+
+// stableExposition drops the lines of volatile metrics from an exposition.
+func stableExposition(exposition []byte) []byte {
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(exposition))
+	for scanner.Scan() {
+		line := scanner.Text()
+		volatile := false
+		for _, name := range volatileMetrics {
+			if strings.HasPrefix(line, name) || strings.HasPrefix(line, "# HELP "+name+" ") || strings.HasPrefix(line, "# TYPE "+name+" ") {
+				volatile = true
+			}
+		}
+		if !volatile {
+			out.WriteString(line + "\n")
+		}
+	}
+	return out.Bytes()
+}
+
+// diffLines lists the lines only found in want or got.
+func diffLines(want, got []byte) string {
+	wantLines := map[string]bool{}
+	for _, line := range strings.Split(string(want), "\n") {
+		wantLines[line] = true
+	}
+	gotLines := map[string]bool{}
+	var diff []string
+	for _, line := range strings.Split(string(got), "\n") {
+		gotLines[line] = true
+		if !wantLines[line] {
+			diff = append(diff, "+ "+line)
+		}
+	}
+	for _, line := range strings.Split(string(want), "\n") {
+		if !gotLines[line] {
+			diff = append(diff, "- "+line)
+		}
+	}
+	return strings.Join(diff, "\n")
+}
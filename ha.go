@@ -0,0 +1,100 @@
+// Copyright 2016 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// haStates are the HA states always exported by sansay_ha_state, so that
+// every state has a series even when the SBC is not in it.
+var haStates = []string{"active", "standby"}
+
+var (
+	haStateDesc = prometheus.NewDesc("sansay_ha_state",
+		"HA state of the SBC, 1 for the current state.",
+		[]string{"state"}, nil)
+	haTransitionsDesc = prometheus.NewDesc("sansay_ha_transitions_total",
+		"Changes of the HA state of the SBC seen between scrapes.",
+		nil, nil)
+	haInfoDesc = prometheus.NewDesc("sansay_ha_info",
+		"Current and previous HA state as reported by the SBC.",
+		[]string{"state", "previous_state"}, nil)
+)
+
+type haStatus struct {
+	state       string
+	transitions float64
+	lastSeen    time.Time
+}
+
+// haTracker remembers the last HA state seen for each target, to count the
+// transitions between scrapes. Targets not scraped within the TTL are
+// forgotten.
+type haTracker struct {
+	ttl time.Duration
+
+	mtx     sync.Mutex
+	entries map[string]haStatus
+}
+
+func newHATracker(ttl time.Duration) *haTracker {
+	return &haTracker{ttl: ttl, entries: map[string]haStatus{}}
+}
+
+// observe records the current state of target and returns the number of
+// transitions seen so far. The first state seen is not a transition.
+func (h *haTracker) observe(target, state string) float64 {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.evict()
+	entry, ok := h.entries[target]
+	if ok && entry.state != state {
+		entry.transitions++
+	}
+	entry.state = state
+	entry.lastSeen = time.Now()
+	h.entries[target] = entry
+	return entry.transitions
+}
+
+// evict drops the targets not seen within the TTL. h.mtx must be held.
+func (h *haTracker) evict() {
+	for target, entry := range h.entries {
+		if time.Since(entry.lastSeen) > h.ttl {
+			delete(h.entries, target)
+		}
+	}
+}
+
+// haTransitions holds the HA state of the targets across scrapes. Targets
+// are forgotten along with their clients, after --sansay.client-ttl.
+var haTransitions = newHATracker(30 * time.Minute)
+
+// addHAMetrics creates the HA metrics from the ha_current_state and
+// ha_pre_state fields of the system_stat table.
+func (c collector) addHAMetrics(ch chan<- prometheus.Metric, current, previous string) {
+	current = strings.ToLower(strings.TrimSpace(current))
+	previous = strings.ToLower(strings.TrimSpace(previous))
+	if current == "" {
+		return
+	}
+	sendStateSet(ch, haStateDesc, haStates, current)
+	ch <- prometheus.MustNewConstMetric(haTransitionsDesc, prometheus.CounterValue, haTransitions.observe(c.target, current))
+	ch <- prometheus.MustNewConstMetric(haInfoDesc, prometheus.GaugeValue, 1, current, previous)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/ringsq/sansay_exporter/config"
+)
+
+func TestHAMetrics(t *testing.T) {
+	module := config.DefaultModule
+	c := collector{target: "ha-test", module: &module, logger: log.NewNopLogger()}
+	defer func(h *haTracker) { haTransitions = h }(haTransitions)
+	haTransitions = newHATracker(time.Hour)
+
+	tests := []struct {
+		current, previous string
+		want              map[string]float64
+	}{
+		{
+			current: "active", previous: "standby",
+			want: map[string]float64{
+				`sansay_ha_state{state="active"}`:                         1,
+				`sansay_ha_state{state="standby"}`:                        0,
+				`sansay_ha_transitions_total{}`:                           0,
+				`sansay_ha_info{previous_state="standby",state="active"}`: 1,
+			},
+		},
+		{
+			current: "Standby", previous: "active",
+			want: map[string]float64{
+				`sansay_ha_state{state="active"}`:                         0,
+				`sansay_ha_state{state="standby"}`:                        1,
+				`sansay_ha_transitions_total{}`:                           1,
+				`sansay_ha_info{previous_state="active",state="standby"}`: 1,
+			},
+		},
+		{
+			current: "alone", previous: "standby",
+			want: map[string]float64{
+				`sansay_ha_state{state="active"}`:                        0,
+				`sansay_ha_state{state="standby"}`:                       0,
+				`sansay_ha_state{state="alone"}`:                         1,
+				`sansay_ha_transitions_total{}`:                          2,
+				`sansay_ha_info{previous_state="standby",state="alone"}`: 1,
+			},
+		},
+	}
+	for i, tt := range tests {
+		payload := fmt.Sprintf(`<mysqldump><database name="sansay"><table name="system_stat"><row>`+
+			`<field name="ha_pre_state">%s</field><field name="ha_current_state">%s</field></row></table></database></mysqldump>`,
+			tt.previous, tt.current)
+		got := map[string]float64{}
+		for _, m := range gatherMetrics(func(ch chan<- prometheus.Metric) {
+			if err := c.processStats(ch, strings.NewReader(payload)); err != nil {
+				t.Error(err)
+			}
+		}) {
+			got[metricKey(t, m)] = metricValue(t, m)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("Scrape %d: expected %d metrics, got %v", i, len(tt.want), got)
+		}
+		for key, value := range tt.want {
+			if v, ok := got[key]; !ok || v != value {
+				t.Errorf("Scrape %d: expected %s %v, got %v", i, key, value, got)
+			}
+		}
+	}
+}
+
+func TestHATrackerEvicts(t *testing.T) {
+	h := newHATracker(time.Minute)
+	h.observe("sbc1", "active")
+	h.observe("sbc1", "standby")
+	entry := h.entries["sbc1"]
+	entry.lastSeen = time.Now().Add(-2 * time.Minute)
+	h.entries["sbc1"] = entry
+
+	h.observe("sbc2", "active")
+	if _, ok := h.entries["sbc1"]; ok {
+		t.Error("Expected the target not seen within the TTL to be evicted")
+	}
+	if transitions := h.observe("sbc1", "active"); transitions != 0 {
+		t.Errorf("Expected the transitions of an evicted target to start over, got %v", transitions)
+	}
+}
+
+func TestHAMetricsMissing(t *testing.T) {
+	module := config.DefaultModule
+	c := collector{module: &module, logger: log.NewNopLogger()}
+	payload := `<mysqldump><database name="sansay"><table name="system_stat"><row><field name="cpu">5</field></row></table></database></mysqldump>`
+	metrics := gatherMetrics(func(ch chan<- prometheus.Metric) {
+		if err := c.processStats(ch, strings.NewReader(payload)); err != nil {
+			t.Error(err)
+		}
+	})
+	if len(metrics) != 1 {
+		t.Errorf("Expected only the cpu metric without HA fields, got %d metrics", len(metrics))
+	}
+}
+
+// metricKey returns the name and labels of a metric, like the exposition format.
+func metricKey(t *testing.T, m prometheus.Metric) string {
+	var pb dto.Metric
+	if err := m.Write(&pb); err != nil {
+		t.Fatal(err)
+	}
+	labels := ""
+	for i, l := range pb.Label {
+		if i > 0 {
+			labels += ","
+		}
+		labels += fmt.Sprintf("%s=%q", l.GetName(), l.GetValue())
+	}
+	return metricName(m) + "{" + labels + "}"
+}
+
+func metricValue(t *testing.T, m prometheus.Metric) float64 {
+	var pb dto.Metric
+	if err := m.Write(&pb); err != nil {
+		t.Fatal(err)
+	}
+	switch {
+	case pb.Gauge != nil:
+		return pb.Gauge.GetValue()
+	case pb.Counter != nil:
+		return pb.Counter.GetValue()
+	}
+	return 0
+}
@@ -0,0 +1,196 @@
+// Copyright 2016 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	requestQueueDepth = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "sansay_request_queue_depth",
+			Help: "Requests to Sansay targets waiting for a free slot",
+		},
+		[]string{"scope"},
+	)
+	requestQueueWait = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "sansay_request_queue_wait_seconds",
+			Help:    "Time requests to Sansay targets waited for a free slot",
+			Buckets: []float64{.001, .01, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		},
+	)
+	requestRejections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sansay_request_rejections_total",
+			Help: "Requests to Sansay targets rejected because the wait queue was full",
+		},
+		[]string{"scope"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(requestQueueDepth)
+	prometheus.MustRegister(requestQueueWait)
+	prometheus.MustRegister(requestRejections)
+}
+
+// Scopes of the request limits.
+const (
+	scopeGlobal = "global"
+	scopeTarget = "target"
+)
+
+// queueFullError is returned when a request cannot be queued because too many
+// requests are already waiting.
+type queueFullError struct {
+	scope string
+}
+
+func (e *queueFullError) Error() string {
+	return fmt.Sprintf("too many requests queued for the %s limit", e.scope)
+}
+
+// semaphore limits the requests in flight, with a bounded number of waiters.
+// A limit of 0 does not limit anything.
+type semaphore struct {
+	scope    string
+	limit    int
+	maxQueue int
+	slots    chan struct{}
+
+	mtx     sync.Mutex
+	waiting int
+	users   int
+}
+
+func newSemaphore(scope string, limit, maxQueue int) *semaphore {
+	return &semaphore{
+		scope:    scope,
+		limit:    limit,
+		maxQueue: maxQueue,
+		slots:    make(chan struct{}, limit),
+	}
+}
+
+func (s *semaphore) acquire(ctx context.Context) error {
+	if s.limit <= 0 {
+		return nil
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	s.mtx.Lock()
+	if s.waiting >= s.maxQueue {
+		s.mtx.Unlock()
+		requestRejections.WithLabelValues(s.scope).Inc()
+		return &queueFullError{scope: s.scope}
+	}
+	s.waiting++
+	s.mtx.Unlock()
+	requestQueueDepth.WithLabelValues(s.scope).Inc()
+	defer func() {
+		s.mtx.Lock()
+		s.waiting--
+		s.mtx.Unlock()
+		requestQueueDepth.WithLabelValues(s.scope).Dec()
+	}()
+
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *semaphore) release() {
+	if s.limit <= 0 {
+		return
+	}
+	<-s.slots
+}
+
+// requestLimiter bounds the number of requests in flight to Sansay targets,
+// both globally and per target.
+type requestLimiter struct {
+	global *semaphore
+
+	mtx     sync.Mutex
+	targets map[string]*semaphore
+}
+
+func newRequestLimiter(limit, maxQueue int) *requestLimiter {
+	return &requestLimiter{
+		global:  newSemaphore(scopeGlobal, limit, maxQueue),
+		targets: map[string]*semaphore{},
+	}
+}
+
+// acquire waits for a free slot for a request to target, within the global
+// limit and the limit of the module for the target. The returned function
+// frees the slot.
+func (l *requestLimiter) acquire(ctx context.Context, target, module string, limit, maxQueue int) (func(), error) {
+	start := time.Now()
+	key := target + "|" + module
+	ts := l.target(key, limit, maxQueue)
+	if err := ts.acquire(ctx); err != nil {
+		l.done(key, ts)
+		return nil, err
+	}
+	if err := l.global.acquire(ctx); err != nil {
+		ts.release()
+		l.done(key, ts)
+		return nil, err
+	}
+	requestQueueWait.Observe(time.Since(start).Seconds())
+	return func() {
+		l.global.release()
+		ts.release()
+		l.done(key, ts)
+	}, nil
+}
+
+// target returns the semaphore of key, creating it if there is none or the
+// limits changed.
+func (l *requestLimiter) target(key string, limit, maxQueue int) *semaphore {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	ts, ok := l.targets[key]
+	if !ok || ts.limit != limit || ts.maxQueue != maxQueue {
+		ts = newSemaphore(scopeTarget, limit, maxQueue)
+		l.targets[key] = ts
+	}
+	ts.users++
+	return ts
+}
+
+// done forgets the semaphore of key once no request uses it anymore.
+func (l *requestLimiter) done(key string, ts *semaphore) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	ts.users--
+	if ts.users == 0 && l.targets[key] == ts {
+		delete(l.targets, key)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRequestLimiterPerTarget(t *testing.T) {
+	l := newRequestLimiter(0, 0)
+	ctx := context.Background()
+
+	release1, err := l.acquire(ctx, "sbc1", "default", 1, 1)
+	if err != nil {
+		t.Fatalf("First request rejected: %s", err)
+	}
+	// Another target has its own limit.
+	releaseOther, err := l.acquire(ctx, "sbc2", "default", 1, 1)
+	if err != nil {
+		t.Fatalf("Request to another target rejected: %s", err)
+	}
+	releaseOther()
+
+	acquired := make(chan func())
+	go func() {
+		release, err := l.acquire(ctx, "sbc1", "default", 1, 1)
+		if err != nil {
+			t.Errorf("Queued request rejected: %s", err)
+		}
+		acquired <- release
+	}()
+	// Wait for the second request to be queued.
+	for {
+		l.mtx.Lock()
+		ts := l.targets["sbc1|default"]
+		ts.mtx.Lock()
+		waiting := ts.waiting
+		ts.mtx.Unlock()
+		l.mtx.Unlock()
+		if waiting == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := l.acquire(ctx, "sbc1", "default", 1, 1); err == nil {
+		t.Fatal("Expected a request to be rejected when the queue is full")
+	} else if errorClass(err) != errorClassRejected {
+		t.Errorf("Expected a rejection, got %s", err)
+	}
+
+	release1()
+	select {
+	case release2 := <-acquired:
+		release2()
+	case <-time.After(5 * time.Second):
+		t.Fatal("Queued request did not get a slot")
+	}
+
+	if len(l.targets) != 0 {
+		t.Errorf("Expected unused targets to be forgotten, got %d", len(l.targets))
+	}
+}
+
+func TestRequestLimiterGlobalTimeout(t *testing.T) {
+	l := newRequestLimiter(1, 5)
+	release, err := l.acquire(context.Background(), "sbc1", "default", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx, "sbc2", "default", 0, 0); err != context.DeadlineExceeded {
+		t.Errorf("Expected the request to time out waiting for the global limit, got %v", err)
+	}
+}
+
+func TestRequestLimiterPerModule(t *testing.T) {
+	l := newRequestLimiter(0, 0)
+	release, err := l.acquire(context.Background(), "sbc1", "a", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	// Another module has its own slots for the same target, even with the
+	// same limits.
+	releaseOther, err := l.acquire(context.Background(), "sbc1", "b", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer releaseOther()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx, "sbc1", "a", 1, 1); err != context.DeadlineExceeded {
+		t.Errorf("Expected the request to wait for the module's limit, got %v", err)
+	}
+}
@@ -14,12 +14,14 @@
 package main
 
 import (
-	"crypto/tls"
+	"context"
 	"fmt"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
-	"strings"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -29,16 +31,30 @@ import (
 	"github.com/prometheus/common/promlog"
 	"github.com/prometheus/common/promlog/flag"
 	"github.com/prometheus/common/version"
+	"github.com/ringsq/sansay_exporter/config"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
-const targetPath = "/SSConfig/webresources/"
-
 var Version = "dev"
 
 var (
+	configFile    = kingpin.Flag("config.file", "Path to configuration file.").Default("sansay.yml").String()
 	listenAddress = kingpin.Flag("web.listen-address", "Address to listen on for web interface and telemetry.").Default(":9116").String()
 	dryRun        = kingpin.Flag("dry-run", "Only verify configuration is valid and exit.").Default("false").Bool()
+	timeoutOffset = kingpin.Flag("timeout-offset", "Offset to subtract from timeout in seconds.").Default("0.5").Float64()
+	maxRequests   = kingpin.Flag("sansay.max-concurrent-requests", "Maximum number of requests in flight to all targets, 0 for no limit.").Default("0").Int()
+	maxQueued     = kingpin.Flag("sansay.max-queued-requests", "Maximum number of requests waiting for the global limit.").Default("100").Int()
+	idleTimeout   = kingpin.Flag("sansay.idle-connection-timeout", "How long idle connections to targets are kept open.").Default("90s").Duration()
+	clientTTL     = kingpin.Flag("sansay.client-ttl", "How long the HTTP client and the HA state of a target are kept after its last request.").Default("30m").Duration()
+	replay        = kingpin.Flag("replay.dir", "Serve the payloads recorded in this directory instead of querying targets.").String()
+
+	serveCmd      = kingpin.Command("serve", "Serve metrics of Sansay targets (default).").Default()
+	recordCmd     = kingpin.Command("record", "Save the payloads returned by a target as fixtures.")
+	recordTarget  = recordCmd.Flag("target", "Target to record.").Required().String()
+	recordModule  = recordCmd.Flag("module", "Module used to query the target.").Default("default").String()
+	recordDir     = recordCmd.Flag("output.dir", "Directory the fixtures are written to.").Default("fixtures").String()
+	recordScrub   = recordCmd.Flag("scrub", "Replace credentials, IP addresses and company names in the fixtures.").Default("true").Bool()
+	recordTimeout = recordCmd.Flag("timeout", "Timeout of the recording.").Default("1m").Duration()
 
 	// Metrics about the sansay exporter itself.
 	sansayDuration = prometheus.NewSummary(
@@ -53,40 +69,87 @@ var (
 			Help: "Errors in requests to the sansay exporter",
 		},
 	)
+	sansayCoalescedRequests = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "sansay_coalesced_requests_total",
+			Help: "Scrapes answered with the results of an identical scrape already in flight",
+		},
+	)
+	sansayCollectorErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sansay_collector_errors_total",
+			Help: "Failed sub-collector requests to Sansay targets",
+		},
+		[]string{"collector", "class"},
+	)
+	sansayParseErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sansay_parse_errors_total",
+			Help: "Fields returned by Sansay targets that could not be parsed",
+		},
+		[]string{"table", "field"},
+	)
 )
 
 func init() {
 	version.Version = Version
 	prometheus.MustRegister(sansayDuration)
 	prometheus.MustRegister(sansayRequestErrors)
+	prometheus.MustRegister(sansayCoalescedRequests)
+	prometheus.MustRegister(sansayCollectorErrors)
+	prometheus.MustRegister(sansayParseErrors)
 	prometheus.MustRegister(version.NewCollector("sansay_exporter"))
 }
 
-func handler(w http.ResponseWriter, r *http.Request, logger log.Logger) {
-	useSoap := false
+func handler(w http.ResponseWriter, r *http.Request, logger log.Logger, sc *config.SafeConfig, p *poller) {
 	target := r.URL.Query().Get("target")
 	if target == "" {
 		http.Error(w, "'target' parameter must be specified", 400)
 		sansayRequestErrors.Inc()
 		return
 	}
-	username := r.URL.Query().Get("username")
-	password := r.URL.Query().Get("password")
-	protocol := r.URL.Query().Get("protocol")
-	if protocol == "" {
-		protocol = "https"
+	moduleName := r.URL.Query().Get("module")
+	if moduleName == "" {
+		moduleName = "default"
+	}
+	module, ok := sc.Get().Modules[moduleName]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown module '%s'", moduleName), 400)
+		sansayRequestErrors.Inc()
+		return
+	}
+
+	collectors := r.URL.Query()["collect[]"]
+	if err := checkCollectors(module, collectors); err != nil {
+		http.Error(w, err.Error(), 400)
+		sansayRequestErrors.Inc()
+		return
 	}
-	api := r.URL.Query().Get("api")
-	if strings.ToLower(api) == "soap" {
-		useSoap = true
+
+	timeoutSeconds, err := getTimeout(r, module, *timeoutOffset)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to parse timeout from Prometheus header: %s", err), http.StatusInternalServerError)
+		sansayRequestErrors.Inc()
+		return
 	}
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(timeoutSeconds*float64(time.Second)))
+	defer cancel()
 
-	logger = log.With(logger, "target", target)
-	level.Debug(logger).Log("msg", "Starting scrape", "module")
+	logger = log.With(logger, "module", moduleName, "target", target)
+	level.Debug(logger).Log("msg", "Starting scrape", "timeout_seconds", timeoutSeconds)
 
 	start := time.Now()
 	registry := prometheus.NewRegistry()
-	collector := collector{target: fmt.Sprintf("%s://%s", protocol, target), targetPath: targetPath, useSoap: useSoap, username: username, password: password, logger: logger}
+	collector, err := newCollector(ctx, fmt.Sprintf("%s://%s", module.Protocol, target), module, collectors, logger)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error creating collector: %s", err), 500)
+		sansayRequestErrors.Inc()
+		return
+	}
+	if cache := p.Cache(target, moduleName); cache != nil {
+		level.Debug(logger).Log("msg", "Serving cached results of polled target")
+		collector.cache = cache
+	}
 	registry.MustRegister(collector)
 	registry.MustRegister(version.NewCollector("sansay_exporter"))
 
@@ -98,28 +161,153 @@ func handler(w http.ResponseWriter, r *http.Request, logger log.Logger) {
 	level.Debug(logger).Log("msg", "Finished scrape", "duration_seconds", duration)
 }
 
-func main() {
-	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+// checkCollectors verifies that every requested collector exists and is enabled
+// in the module.
+func checkCollectors(module *config.Module, collectors []string) error {
+	for _, name := range collectors {
+		if !config.ValidCollector(name) {
+			return fmt.Errorf("Unknown collector '%s'", name)
+		}
+		enabled := false
+		for _, c := range module.Collectors {
+			if c == name {
+				enabled = true
+				break
+			}
+		}
+		if !enabled {
+			return fmt.Errorf("Collector '%s' is not enabled in the module", name)
+		}
+	}
+	return nil
+}
+
+// getTimeout returns the time allowed for a scrape. It is the Prometheus scrape
+// timeout less the offset, capped by the module timeout.
+func getTimeout(r *http.Request, module *config.Module, offset float64) (timeoutSeconds float64, err error) {
+	// If a timeout is configured via the Prometheus header, add it to the request.
+	if v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); v != "" {
+		timeoutSeconds, err = strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if timeoutSeconds == 0 {
+		timeoutSeconds = 10
+	}
+
+	var maxTimeoutSeconds = timeoutSeconds - offset
+	if maxTimeoutSeconds <= 0 {
+		maxTimeoutSeconds = timeoutSeconds
+	}
+	if module.Timeout > 0 && module.Timeout.Seconds() < maxTimeoutSeconds {
+		return module.Timeout.Seconds(), nil
+	}
+	return maxTimeoutSeconds, nil
+}
+
+// runRecord records the target given on the command line and returns the
+// exit code.
+func runRecord(logger log.Logger) int {
+	conf, err := config.LoadFile(*configFile)
+	if err != nil {
+		level.Error(logger).Log("msg", "Error parsing config file", "file", *configFile, "err", err)
+		return 1
+	}
+	module, ok := conf.Modules[*recordModule]
+	if !ok {
+		level.Error(logger).Log("msg", "Unknown module", "module", *recordModule)
+		return 1
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *recordTimeout)
+	defer cancel()
+	if err := record(ctx, *recordTarget, module, *recordDir, *recordScrub, logger); err != nil {
+		level.Error(logger).Log("msg", "Error recording target", "target", *recordTarget, "err", err)
+		return 1
+	}
+	return 0
+}
 
+func main() {
 	promlogConfig := &promlog.Config{}
 	flag.AddFlags(kingpin.CommandLine, promlogConfig)
 	kingpin.HelpFlag.Short('h')
-	kingpin.Parse()
+	command := kingpin.Parse()
 	logger := promlog.New(promlogConfig)
 
+	if command == recordCmd.FullCommand() {
+		os.Exit(runRecord(logger))
+	}
+
 	level.Info(logger).Log("msg", "Starting sansay_exporter", "version", version.Info())
 	level.Info(logger).Log("msg", "Build context", version.BuildContext())
 
+	sc := &config.SafeConfig{}
+	if err := sc.ReloadConfig(*configFile); err != nil {
+		level.Error(logger).Log("msg", "Error parsing config file", "file", *configFile, "err", err)
+		os.Exit(1)
+	}
+
 	// Exit if in dry-run mode.
 	if *dryRun {
-		level.Info(logger).Log("msg", "Configuration parsed successfully")
+		level.Info(logger).Log("msg", "Configuration parsed successfully", "file", *configFile, "modules", len(sc.Get().Modules))
 		return
 	}
 
+	limiter = newRequestLimiter(*maxRequests, *maxQueued)
+	clients = newClientPool(*idleTimeout, *clientTTL)
+	haTransitions = newHATracker(*clientTTL)
+	replayDir = *replay
+	if replayDir != "" {
+		level.Warn(logger).Log("msg", "Serving recorded payloads instead of querying targets", "dir", replayDir)
+	}
+
+	p := newPoller(logger)
+	p.Update(sc.Get())
+
+	hup := make(chan os.Signal, 1)
+	reloadCh := make(chan chan error)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-hup:
+				if err := sc.ReloadConfig(*configFile); err != nil {
+					level.Error(logger).Log("msg", "Error reloading config", "err", err)
+				} else {
+					level.Info(logger).Log("msg", "Loaded config file")
+					p.Update(sc.Get())
+				}
+			case rc := <-reloadCh:
+				if err := sc.ReloadConfig(*configFile); err != nil {
+					level.Error(logger).Log("msg", "Error reloading config", "err", err)
+					rc <- err
+				} else {
+					level.Info(logger).Log("msg", "Loaded config file")
+					p.Update(sc.Get())
+					rc <- nil
+				}
+			}
+		}
+	}()
+
 	http.Handle("/metrics", promhttp.Handler()) // Normal metrics endpoint for sansay exporter itself.
 	// Endpoint to do sansay scrapes.
 	http.HandleFunc("/sansay", func(w http.ResponseWriter, r *http.Request) {
-		handler(w, r, logger)
+		handler(w, r, logger, sc, p)
+	})
+	http.HandleFunc("/-/reload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			fmt.Fprintf(w, "This endpoint requires a POST request.\n")
+			return
+		}
+
+		rc := make(chan error)
+		reloadCh <- rc
+		if err := <-rc; err != nil {
+			http.Error(w, fmt.Sprintf("failed to reload config: %s", err), http.StatusInternalServerError)
+		}
 	})
 
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -143,6 +331,7 @@ func main() {
             <h1>Sansay Exporter</h1>
             <form action="/sansay">
             <label>Target:</label> <input type="text" name="target" placeholder="X.X.X.X" value="1.2.3.4"><br>
+            <label>Module:</label> <input type="text" name="module" placeholder="module" value="default"><br>
             <input type="submit" value="Submit">
             </form>
             </body>
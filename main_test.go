@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ringsq/sansay_exporter/config"
+)
+
+func TestGetTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		timeout time.Duration
+		want    float64
+	}{
+		{name: "no header", want: 9.5},
+		{name: "header less offset", header: "15", want: 14.5},
+		{name: "module timeout shorter", header: "15", timeout: 5 * time.Second, want: 5},
+		{name: "module timeout longer", header: "15", timeout: 30 * time.Second, want: 14.5},
+		{name: "offset larger than header", header: "0.25", want: 0.25},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "/sansay", nil)
+			if tt.header != "" {
+				r.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", tt.header)
+			}
+			got, err := getTimeout(r, &config.Module{Timeout: tt.timeout}, 0.5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected timeout %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCheckCollectors(t *testing.T) {
+	module := &config.Module{Collectors: []string{"realtime", "media_server"}}
+	tests := []struct {
+		collectors []string
+		wantErr    bool
+	}{
+		{collectors: nil},
+		{collectors: []string{"realtime"}},
+		{collectors: []string{"realtime", "media_server"}},
+		{collectors: []string{"resource_config"}, wantErr: true},
+		{collectors: []string{"bogus"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		err := checkCollectors(module, tt.collectors)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("checkCollectors(%v) error = %v, wantErr %v", tt.collectors, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2016 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// trunkTables maps the tables whose rows describe trunks to the direction of
+// their traffic, if any.
+var trunkTables = map[string]string{
+	"XBResourceRealTimeStatList": "",
+	"ingress_stat":               "ingress",
+	"gw_egress_stat":             "egress",
+}
+
+// trunkFields gives access to the fields of a Trunk by name, so rows can be
+// decoded without reflection. Names are accepted with the first letter in
+// upper or lower case, as sent by the SBC.
+var trunkFields = map[string]func(*Trunk) *string{
+	"TrunkId":               func(t *Trunk) *string { return &t.TrunkId },
+	"Alias":                 func(t *Trunk) *string { return &t.Alias },
+	"Fqdn":                  func(t *Trunk) *string { return &t.Fqdn },
+	"NumOrig":               func(t *Trunk) *string { return &t.NumOrig },
+	"NumTerm":               func(t *Trunk) *string { return &t.NumTerm },
+	"Cps":                   func(t *Trunk) *string { return &t.Cps },
+	"NumPeak":               func(t *Trunk) *string { return &t.NumPeak },
+	"TotalCLZ":              func(t *Trunk) *string { return &t.TotalCLZ },
+	"NumCLZCps":             func(t *Trunk) *string { return &t.NumCLZCps },
+	"TotalLimit":            func(t *Trunk) *string { return &t.TotalLimit },
+	"CpsLimit":              func(t *Trunk) *string { return &t.CpsLimit },
+	"Fifteen_Calls_Attempt": func(t *Trunk) *string { return &t.Fifteen_Calls_Attempt },
+	"Fifteen_Calls_Answer":  func(t *Trunk) *string { return &t.Fifteen_Calls_Answer },
+	"Fifteen_Calls_Fail":    func(t *Trunk) *string { return &t.Fifteen_Calls_Fail },
+	"Hour_Calls_Attempt":    func(t *Trunk) *string { return &t.Hour_Calls_Attempt },
+	"Hour_Calls_Answer":     func(t *Trunk) *string { return &t.Hour_Calls_Answer },
+	"Hour_Calls_Fail":       func(t *Trunk) *string { return &t.Hour_Calls_Fail },
+	"Day_Calls_Attempt":     func(t *Trunk) *string { return &t.Day_Calls_Attempt },
+	"Day_Calls_Answer":      func(t *Trunk) *string { return &t.Day_Calls_Answer },
+	"Day_Calls_Fail":        func(t *Trunk) *string { return &t.Day_Calls_Fail },
+	"Fifteen_Duration":      func(t *Trunk) *string { return &t.Fifteen_Duration },
+	"Hour_Duration":         func(t *Trunk) *string { return &t.Hour_Duration },
+	"Day_Duration":          func(t *Trunk) *string { return &t.Day_Duration },
+	"Fifteen_PDD":           func(t *Trunk) *string { return &t.Fifteen_PDD },
+	"Hour_PDD":              func(t *Trunk) *string { return &t.Hour_PDD },
+	"Day_PDD":               func(t *Trunk) *string { return &t.Day_PDD },
+	"Direction":             func(t *Trunk) *string { return &t.Direction },
+}
+
+func init() {
+	for name, field := range trunkFields {
+		trunkFields[strings.ToLower(name[:1])+name[1:]] = field
+	}
+}
+
+// set sets the named field of the trunk. Unknown fields are ignored.
+func (t *Trunk) set(name, value string) {
+	if field, ok := trunkFields[name]; ok {
+		*field(t) = value
+	}
+}
+
+// get returns the value of the named field of the trunk.
+func (t *Trunk) get(name string) (string, error) {
+	field, ok := trunkFields[name]
+	if !ok {
+		return "", fmt.Errorf("not a field name: %s", name)
+	}
+	return *field(t), nil
+}
+
+// statsField is a field of a row in a mysqldump payload.
+type statsField struct {
+	name  string
+	value string
+}
+
+// newTrunk creates the trunk described by a row of a trunk table.
+func newTrunk(table string, fields []statsField) Trunk {
+	trunk := Trunk{Direction: trunkTables[table]}
+	for _, field := range fields {
+		name := field.name
+		if name == "trunk_id" {
+			name = "trunkId"
+		}
+		if mapped, ok := trunkfields[name]; ok {
+			name = mapped
+		}
+		trunk.set(name, field.value)
+	}
+	return trunk
+}
+
+// decodeStats decodes a mysqldump payload, as returned for stats/realtime,
+// stats/resource and stats/system, row by row from r with a streaming
+// decoder. fn is called with the table name and the fields of each row as
+// soon as the row is read; fields is reused once fn returns.
+func decodeStats(r io.Reader, fn func(table string, fields []statsField)) error {
+	var (
+		table   string
+		inTable bool
+		fields  []statsField
+		name    string
+		text    []byte
+		root    bool
+		depth   int
+		inRow   bool
+		inField bool
+	)
+	d := xml.NewDecoder(r)
+	for {
+		// RawToken skips namespace translation, which the payload does not
+		// need; unbalanced elements are caught by tracking the depth.
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			if depth != 0 {
+				return io.ErrUnexpectedEOF
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if !root {
+				if t.Name.Local != "mysqldump" {
+					return fmt.Errorf("expected element type <mysqldump> but have <%s>", t.Name.Local)
+				}
+				root = true
+				continue
+			}
+			switch t.Name.Local {
+			case "table":
+				table = attr(t, "name")
+				inTable = true
+			case "row":
+				fields = fields[:0]
+				inRow = true
+			case "field":
+				if inRow {
+					name = attr(t, "name")
+					text = text[:0]
+					inField = true
+				}
+			}
+		case xml.CharData:
+			if inField {
+				text = append(text, t...)
+			}
+		case xml.EndElement:
+			depth--
+			switch t.Name.Local {
+			case "field":
+				if inField {
+					fields = append(fields, statsField{name: name, value: string(text)})
+					inField = false
+				}
+			case "row":
+				if inRow && inTable {
+					fn(table, fields)
+				}
+				inRow = false
+			case "table":
+				inTable = false
+			}
+		}
+	}
+	if !root {
+		return io.EOF
+	}
+	return nil
+}
+
+// attr returns the value of the named attribute of an element.
+func attr(e xml.StartElement, name string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/ringsq/sansay_exporter/config"
+)
+
+func readFixture(t testing.TB, name string) []byte {
+	data, err := ioutil.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// decodeTrunks decodes the fixture and returns its rows by table, and the
+// trunks of the trunk tables.
+func decodeTrunks(t *testing.T, fixture string) (map[string]int, []Trunk) {
+	rows := map[string]int{}
+	var trunks []Trunk
+	err := decodeStats(bytes.NewReader(readFixture(t, fixture)), func(table string, fields []statsField) {
+		rows[table]++
+		if _, ok := trunkTables[table]; ok {
+			trunks = append(trunks, newTrunk(table, fields))
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows, trunks
+}
+
+func TestDecodeStats(t *testing.T) {
+	rows, trunks := decodeTrunks(t, "stats_resource.xml")
+	if len(rows) != 2 || rows["ingress_stat"] != 200 {
+		t.Fatalf("Unexpected tables %v", rows)
+	}
+	trunk := trunks[0]
+	if trunk.TrunkId != "1000" || trunk.Alias != "carrier-000" || trunk.Direction != "ingress" || trunk.Day_PDD == "" {
+		t.Errorf("Unexpected trunk %+v", trunk)
+	}
+
+	rows, trunks = decodeTrunks(t, "stats_realtime.xml")
+	if rows["system_stat"] != 1 {
+		t.Fatalf("Unexpected system table with %d rows", rows["system_stat"])
+	}
+	if len(trunks) != 600 || trunks[0].Fqdn != "Group" {
+		t.Errorf("Unexpected realtime table with %d trunks", len(trunks))
+	}
+}
+
+func TestDecodeStatsErrors(t *testing.T) {
+	for _, payload := range []string{
+		"",
+		"<xml>response</xml>",
+		`<mysqldump><database name="sansay"><table name="system_stat"><row><field name="cps">1`,
+	} {
+		if err := decodeStats(strings.NewReader(payload), func(string, []statsField) {}); err == nil {
+			t.Errorf("Expected an error decoding %q", payload)
+		}
+	}
+}
+
+func BenchmarkDecodeStats(b *testing.B) {
+	for _, fixture := range []string{"stats_realtime.xml", "stats_resource.xml"} {
+		data := readFixture(b, fixture)
+		b.Run(fixture, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := decodeStats(bytes.NewReader(data), func(string, []statsField) {}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkProcessStats(b *testing.B) {
+	module := config.DefaultModule
+	c := collector{module: &module, logger: log.NewNopLogger()}
+	for _, fixture := range []string{"stats_realtime.xml", "stats_resource.xml"} {
+		data := readFixture(b, fixture)
+		b.Run(fixture, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				gatherMetrics(func(ch chan<- prometheus.Metric) {
+					if err := c.processStats(ch, bytes.NewReader(data)); err != nil {
+						b.Fatal(err)
+					}
+				})
+			}
+		})
+	}
+}
+
+// mysqldump is the document tree the payloads used to be unmarshalled into.
+type mysqldump struct {
+	XMLName  xml.Name `xml:"mysqldump"`
+	Database struct {
+		Table []struct {
+			Name string `xml:"name,attr"`
+			Row  []struct {
+				Field []struct {
+					Text string `xml:",chardata"`
+					Name string `xml:"name,attr"`
+				} `xml:"field"`
+			} `xml:"row"`
+		} `xml:"table"`
+	} `xml:"database"`
+}
+
+// BenchmarkUnmarshalStats measures the previous approach of unmarshalling the
+// whole document and setting the trunk fields with reflection, as a baseline
+// for BenchmarkDecodeStats.
+func BenchmarkUnmarshalStats(b *testing.B) {
+	for _, fixture := range []string{"stats_realtime.xml", "stats_resource.xml"} {
+		data := readFixture(b, fixture)
+		b.Run(fixture, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var dump mysqldump
+				if err := xml.Unmarshal(data, &dump); err != nil {
+					b.Fatal(err)
+				}
+				for _, table := range dump.Database.Table {
+					for _, row := range table.Row {
+						trunk := Trunk{}
+						for _, field := range row.Field {
+							name := field.Name
+							if mapped, ok := trunkfields[name]; ok {
+								name = mapped
+							}
+							name = strings.Map(unicode.ToUpper, name[:1]) + name[1:]
+							if fv := reflect.ValueOf(&trunk).Elem().FieldByName(name); fv.IsValid() {
+								fv.SetString(field.Text)
+							}
+						}
+					}
+				}
+			}
+		})
+	}
+}
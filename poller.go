@@ -0,0 +1,233 @@
+// Copyright 2016 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/ringsq/sansay_exporter/config"
+)
+
+// defaultPollTimeout bounds a background poll when the module has no timeout.
+const defaultPollTimeout = 10 * time.Second
+
+// cachedResult holds the metrics produced by the latest poll of a sub-collector.
+type cachedResult struct {
+	metrics []prometheus.Metric
+	success bool
+	time    time.Time
+}
+
+// targetCache holds the latest results of each sub-collector of a polled target.
+type targetCache struct {
+	mtx     sync.RWMutex
+	results map[string]cachedResult
+	expiry  time.Time
+	api     string
+}
+
+func newTargetCache() *targetCache {
+	return &targetCache{results: map[string]cachedResult{}}
+}
+
+func (tc *targetCache) store(name string, result cachedResult, expiry time.Time, api string) {
+	tc.mtx.Lock()
+	defer tc.mtx.Unlock()
+	tc.results[name] = result
+	if !expiry.IsZero() {
+		tc.expiry = expiry
+	}
+	if api != "" {
+		tc.api = api
+	}
+}
+
+// retain drops the results of sub-collectors that are no longer polled.
+func (tc *targetCache) retain(collectors []string) {
+	tc.mtx.Lock()
+	defer tc.mtx.Unlock()
+	for name := range tc.results {
+		keep := false
+		for _, c := range collectors {
+			if c == name {
+				keep = true
+				break
+			}
+		}
+		if !keep {
+			delete(tc.results, name)
+		}
+	}
+}
+
+// collect sends the cached metrics of the named sub-collectors, along with the
+// age of the data they were created from.
+func (tc *targetCache) collect(ch chan<- prometheus.Metric, collectors []string) {
+	tc.mtx.RLock()
+	defer tc.mtx.RUnlock()
+	up := false
+	seen := make(map[string]bool, len(collectors))
+	for _, name := range collectors {
+		result, ok := tc.results[name]
+		if !ok || seen[name] {
+			continue
+		}
+		seen[name] = true
+		for _, m := range result.metrics {
+			ch <- m
+		}
+		up = up || result.success
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc("sansay_data_age_seconds", "Time since the cached data of the collector was polled from the target", []string{"collector"}, nil),
+			prometheus.GaugeValue,
+			time.Since(result.time).Seconds(), name)
+	}
+	sendTargetMetrics(ch, up, tc.expiry, tc.api)
+}
+
+// poller scrapes the configured poll targets in the background and caches
+// the resulting metrics.
+type poller struct {
+	logger log.Logger
+
+	mtx    sync.RWMutex
+	caches map[string]*targetCache
+	cancel context.CancelFunc
+}
+
+func newPoller(logger log.Logger) *poller {
+	return &poller{
+		logger: logger,
+		caches: map[string]*targetCache{},
+	}
+}
+
+func cacheKey(target, module string) string {
+	return target + "/" + module
+}
+
+// Update stops polling the previous targets and starts polling those of conf.
+// Cached results of targets that are still polled are kept.
+func (p *poller) Update(conf *config.Config) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.cancel != nil {
+		p.cancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+
+	caches := make(map[string]*targetCache, len(conf.Poll))
+	for _, pt := range conf.Poll {
+		key := cacheKey(pt.Target, pt.Module)
+		module := conf.Modules[pt.Module]
+		cache, ok := p.caches[key]
+		if !ok {
+			cache = newTargetCache()
+		}
+		cache.retain(module.Collectors)
+		caches[key] = cache
+		for _, name := range module.Collectors {
+			go p.poll(ctx, pt, module, name, cache)
+		}
+	}
+	p.caches = caches
+	if len(caches) > 0 {
+		level.Info(p.logger).Log("msg", "Polling targets in the background", "targets", len(caches))
+	}
+}
+
+// Cache returns the cache of a polled target, or nil if the target is not polled.
+func (p *poller) Cache(target, module string) *targetCache {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+	return p.caches[cacheKey(target, module)]
+}
+
+// poll runs one sub-collector of a target at its interval until ctx is done.
+func (p *poller) poll(ctx context.Context, pt *config.PollTarget, module *config.Module, name string, cache *targetCache) {
+	logger := log.With(p.logger, "module", pt.Module, "target", pt.Target, "collector", name)
+	interval := pt.Interval(name)
+	timeout := module.Timeout
+	if timeout == 0 {
+		timeout = defaultPollTimeout
+	}
+	if timeout > interval {
+		timeout = interval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		level.Debug(logger).Log("msg", "Polling target")
+		pollCtx, cancel := context.WithTimeout(ctx, timeout)
+		// The collector is created for every poll so it uses the pooled
+		// transport of the target.
+		target := fmt.Sprintf("%s://%s", module.Protocol, pt.Target)
+		c, err := newCollector(pollCtx, target, module, []string{name}, logger)
+		result := cachedResult{}
+		if err != nil {
+			// E.g. a TLS file that cannot be read right now. Report the
+			// collector as failed and try again on the next tick.
+			level.Error(logger).Log("msg", "Error creating collector", "err", err)
+			c = collector{target: target, module: module, collectors: []string{name}, logger: logger}
+			result.metrics = gatherMetrics(func(ch chan<- prometheus.Metric) {
+				c.processResult(ch, scrapeResult{path: collectorPaths[name], err: err})
+			})
+		} else {
+			result.metrics = gatherMetrics(func(ch chan<- prometheus.Metric) {
+				for _, r := range c.scrape(c.ctx) {
+					result.success = c.processResult(ch, r)
+				}
+			})
+		}
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		result.time = time.Now()
+		var expiry time.Time
+		if c.transport != nil {
+			expiry, _ = c.transport.Expiry()
+		}
+		cache.store(name, result, expiry, c.api())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// gatherMetrics returns the metrics sent by f.
+func gatherMetrics(f func(ch chan<- prometheus.Metric)) []prometheus.Metric {
+	ch := make(chan prometheus.Metric)
+	done := make(chan []prometheus.Metric)
+	go func() {
+		var metrics []prometheus.Metric
+		for m := range ch {
+			metrics = append(metrics, m)
+		}
+		done <- metrics
+	}()
+	f(ch)
+	close(ch)
+	return <-done
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/ringsq/sansay_exporter/config"
+)
+
+const realtimePayload = `<mysqldump><database name="sansay"><table name="XBResourceRealTimeStatList">
+<row><field name="trunkId">100</field><field name="alias">carrier</field><field name="fqdn">Group</field>
+<field name="numOrig">3</field><field name="numTerm">2</field><field name="cps">0</field><field name="numPeak">7</field>
+<field name="totalCLZ">0</field><field name="numCLZCps">0</field><field name="totalLimit">100</field><field name="cpsLimit">10</field></row>
+</table></database></mysqldump>`
+
+func TestPollerServesCachedResults(t *testing.T) {
+	requests := make(chan struct{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- struct{}{}
+		w.Write([]byte(realtimePayload))
+	}))
+	defer server.Close()
+
+	module := config.DefaultModule
+	module.Protocol = "http"
+	module.Collectors = []string{"realtime"}
+	target := strings.TrimPrefix(server.URL, "http://")
+	conf := &config.Config{
+		Modules: map[string]*config.Module{"default": &module},
+		Poll:    []*config.PollTarget{{Target: target, Module: "default", Intervals: map[string]time.Duration{"realtime": time.Hour}}},
+	}
+
+	p := newPoller(log.NewNopLogger())
+	p.Update(conf)
+	defer p.Update(&config.Config{})
+
+	cache := p.Cache(target, "default")
+	if cache == nil {
+		t.Fatal("Expected the target to be polled")
+	}
+	if p.Cache(target, "other") != nil {
+		t.Error("Expected no cache for a module that is not polled")
+	}
+	select {
+	case <-requests:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Target was not polled")
+	}
+	// Wait for the poll to be stored.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cache.mtx.RLock()
+		_, ok := cache.results["realtime"]
+		cache.mtx.RUnlock()
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Poll results were not cached")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	names := map[string]bool{}
+	for _, m := range gatherMetrics(func(ch chan<- prometheus.Metric) { cache.collect(ch, []string{"realtime"}) }) {
+		names[metricName(m)] = true
+	}
+	for _, want := range []string{"sansay_trunk_numorig", "sansay_data_age_seconds", "sansay_up", "sansay_collector_success"} {
+		if !names[want] {
+			t.Errorf("Expected metric %s in cached results", want)
+		}
+	}
+	if len(requests) != 0 {
+		t.Error("Collecting cached results queried the target")
+	}
+}
+
+func TestPollerRetriesFailedCollector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(realtimePayload))
+	}))
+	defer server.Close()
+	tlsServer := httptest.NewTLSServer(http.NotFoundHandler())
+	tlsServer.Close()
+	dir, err := ioutil.TempDir("", "poller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The CA file is missing until the first poll failed.
+	module := config.DefaultModule
+	module.Protocol = "http"
+	module.Collectors = []string{"realtime"}
+	module.TLSConfig.CAFile = filepath.Join(dir, "ca.pem")
+	target := strings.TrimPrefix(server.URL, "http://")
+	conf := &config.Config{
+		Modules: map[string]*config.Module{"default": &module},
+		Poll:    []*config.PollTarget{{Target: target, Module: "default", Intervals: map[string]time.Duration{"realtime": 20 * time.Millisecond}}},
+	}
+	p := newPoller(log.NewNopLogger())
+	p.Update(conf)
+	defer p.Update(&config.Config{})
+	cache := p.Cache(target, "default")
+
+	waitFor := func(success bool) {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			cache.mtx.RLock()
+			result, ok := cache.results["realtime"]
+			cache.mtx.RUnlock()
+			if ok && result.success == success {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("No poll with success %v was cached", success)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor(false)
+	names := map[string]bool{}
+	for _, m := range gatherMetrics(func(ch chan<- prometheus.Metric) { cache.collect(ch, []string{"realtime"}) }) {
+		names[metricName(m)] = true
+	}
+	if !names["sansay_collector_error"] {
+		t.Error("Expected the failed poll to report sansay_collector_error")
+	}
+
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsServer.Certificate().Raw})
+	if err := ioutil.WriteFile(module.TLSConfig.CAFile, ca, 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(true)
+}
+
+// metricName extracts the fully-qualified name of a metric.
+func metricName(m prometheus.Metric) string {
+	desc := m.Desc().String()
+	start := strings.Index(desc, `fqName: "`) + len(`fqName: "`)
+	return desc[start : start+strings.Index(desc[start:], `"`)]
+}
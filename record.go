@@ -0,0 +1,166 @@
+// Copyright 2016 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/ringsq/sansay_exporter/config"
+	"github.com/ringsq/sansay_exporter/fixture"
+)
+
+// record requests the payloads a scrape of target would request and saves
+// them in dir, named as expected by the simulator and replay mode.
+func record(ctx context.Context, target string, module *config.Module, dir string, scrub bool, logger log.Logger) error {
+	c, err := newCollector(ctx, fmt.Sprintf("%s://%s", module.Protocol, target), module, nil, logger)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	var s *scrubber
+	if scrub {
+		s = newScrubber(module)
+	}
+	failed := 0
+	for _, path := range c.paths() {
+		body, err := readAPI(ctx, c, path)
+		if err != nil {
+			level.Error(logger).Log("msg", "Error recording path", "path", path, "err", err)
+			failed++
+			continue
+		}
+		if s != nil {
+			body = s.scrub(body)
+		}
+		file := filepath.Join(dir, fixture.File(path))
+		if err := ioutil.WriteFile(file, body, 0644); err != nil {
+			return err
+		}
+		level.Info(logger).Log("msg", "Recorded path", "path", path, "file", file, "bytes", len(body))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d paths could not be recorded", failed, len(c.paths()))
+	}
+	return nil
+}
+
+// readAPI requests path from the target and reads the whole payload.
+func readAPI(ctx context.Context, c collector, path string) ([]byte, error) {
+	body, err := callAPI(ctx, c, path)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return ioutil.ReadAll(body)
+}
+
+var (
+	ipAddressRE   = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	companyNameRE = regexp.MustCompile(`(<companyName>|<field name="companyName">)([^<]*)(<)`)
+	// The text of elements and the values of attributes.
+	xmlValueREs = []*regexp.Regexp{
+		regexp.MustCompile(`(>)([^<]*)(<)`),
+		regexp.MustCompile(`(=")([^"]*)(")`),
+		regexp.MustCompile(`(=')([^']*)(')`),
+	}
+)
+
+// scrubber replaces the credentials, IP addresses and company names in
+// recorded payloads. The same value is always replaced by the same
+// placeholder, so the relations within and between payloads are kept.
+type scrubber struct {
+	// Placeholders of the credentials, by their value escaped as in XML.
+	credentials map[string]string
+	addresses   map[string]string
+	companies   map[string]string
+}
+
+func newScrubber(module *config.Module) *scrubber {
+	s := &scrubber{
+		credentials: map[string]string{},
+		addresses:   map[string]string{},
+		companies:   map[string]string{},
+	}
+	if module.Username != "" {
+		s.credentials[xmlEscape(module.Username)] = "user"
+	}
+	if module.Password != "" {
+		s.credentials[xmlEscape(string(module.Password))] = "password"
+	}
+	return s
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+func (s *scrubber) scrub(data []byte) []byte {
+	// Credentials are only replaced where they are a whole value, short ones
+	// also occur within counters and names.
+	for _, re := range xmlValueREs {
+		data = s.scrubCredentials(re, data)
+	}
+	data = ipAddressRE.ReplaceAllFunc(data, func(ip []byte) []byte {
+		// Keep netmasks and wildcard addresses, they do not identify anything.
+		if bytes.HasPrefix(ip, []byte("255.")) || bytes.Equal(ip, []byte("0.0.0.0")) {
+			return ip
+		}
+		scrubbed, ok := s.addresses[string(ip)]
+		if !ok {
+			n := len(s.addresses) + 1
+			scrubbed = fmt.Sprintf("10.%d.%d.%d", n>>16&255, n>>8&255, n&255)
+			s.addresses[string(ip)] = scrubbed
+		}
+		return []byte(scrubbed)
+	})
+	return companyNameRE.ReplaceAllFunc(data, func(match []byte) []byte {
+		parts := companyNameRE.FindSubmatch(match)
+		name := string(parts[2])
+		if name == "" {
+			return match
+		}
+		scrubbed, ok := s.companies[name]
+		if !ok {
+			scrubbed = fmt.Sprintf("Company %d", len(s.companies)+1)
+			s.companies[name] = scrubbed
+		}
+		return []byte(string(parts[1]) + scrubbed + string(parts[3]))
+	})
+}
+
+// scrubCredentials replaces the values matched by the second group of re
+// that are credentials.
+func (s *scrubber) scrubCredentials(re *regexp.Regexp, data []byte) []byte {
+	return re.ReplaceAllFunc(data, func(match []byte) []byte {
+		parts := re.FindSubmatch(match)
+		scrubbed, ok := s.credentials[string(parts[2])]
+		if !ok {
+			return match
+		}
+		return []byte(string(parts[1]) + scrubbed + string(parts[3]))
+	})
+}
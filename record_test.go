@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/ringsq/sansay_exporter/config"
+	"github.com/ringsq/sansay_exporter/fixture"
+	"github.com/ringsq/sansay_exporter/simulator"
+)
+
+func TestRecord(t *testing.T) {
+	for _, api := range []string{apiAuto, apiSOAP} {
+		t.Run(api, func(t *testing.T) {
+			sim, err := simulator.New(simulator.Config{FixturesDir: "testdata"}, log.NewNopLogger())
+			if err != nil {
+				t.Fatal(err)
+			}
+			server := httptest.NewServer(sim)
+			defer server.Close()
+			dir, err := ioutil.TempDir("", "record")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			module := config.DefaultModule
+			module.Protocol = "http"
+			module.API = api
+			module.Collectors = config.Collectors
+			if api == apiSOAP {
+				// The system statistics are merged from a call per statistic.
+				module.Collectors = []string{"realtime", "resource", "media_server", "resource_config"}
+			}
+			target := strings.TrimPrefix(server.URL, "http://")
+			defer apis.forget(server.URL + module.RestPath)
+			if err := record(context.Background(), target, &module, dir, false, log.NewNopLogger()); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range module.Collectors {
+				file := fixture.File(collectorPaths[name])
+				got, err := ioutil.ReadFile(filepath.Join(dir, file))
+				if err != nil {
+					t.Fatal(err)
+				}
+				want, _ := ioutil.ReadFile(filepath.Join("testdata", file))
+				if string(got) != string(want) {
+					t.Errorf("Recorded %s differs from the served fixture", file)
+				}
+			}
+		})
+	}
+}
+
+func TestScrub(t *testing.T) {
+	module := config.DefaultModule
+	module.Username = "admin"
+	module.Password = "s3cret"
+	s := newScrubber(&module)
+	got := string(s.scrub([]byte(`<XBResource><companyName>ACME Telecom</companyName><node><fqdn>203.0.113.7</fqdn><netmask>255.255.255.0</netmask></node><username>admin</username><password>s3cret</password></XBResource>` +
+		`<row><field name="companyName">ACME Telecom</field><field name="fqdn">198.51.100.1</field><field name="ip">203.0.113.7</field></row>`)))
+	want := `<XBResource><companyName>Company 1</companyName><node><fqdn>10.0.0.1</fqdn><netmask>255.255.255.0</netmask></node><username>user</username><password>password</password></XBResource>` +
+		`<row><field name="companyName">Company 1</field><field name="fqdn">10.0.0.2</field><field name="ip">10.0.0.1</field></row>`
+	if got != want {
+		t.Errorf("Unexpected scrubbed payload:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestScrubWholeValues(t *testing.T) {
+	module := config.DefaultModule
+	module.Username = "sa"
+	module.Password = "1234"
+	s := newScrubber(&module)
+	got := string(s.scrub([]byte(`<mysqldump><database name="sansay"><table name="system_stat"><row>` +
+		`<field name="numOrig">12345</field><field name="cps">112.34</field><field name="user">sa</field><field name="pass">1234</field>` +
+		`</row></table></database></mysqldump><login user='sa' password="1234"/>`)))
+	want := `<mysqldump><database name="sansay"><table name="system_stat"><row>` +
+		`<field name="numOrig">12345</field><field name="cps">112.34</field><field name="user">user</field><field name="pass">password</field>` +
+		`</row></table></database></mysqldump><login user='user' password="password"/>`
+	if got != want {
+		t.Errorf("Unexpected scrubbed payload:\n%s\nwant:\n%s", got, want)
+	}
+}
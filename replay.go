@@ -0,0 +1,61 @@
+// Copyright 2016 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/ringsq/sansay_exporter/fixture"
+)
+
+// replayDir holds recorded payloads that are served instead of querying the
+// targets, when set.
+var replayDir string
+
+// readReplay opens the recorded payload of path for the target. Payloads in
+// a subdirectory named after the target take precedence over those shared by
+// all targets.
+func readReplay(c collector, path string) (io.ReadCloser, error) {
+	file := fixture.File(path)
+	target := c.target
+	if i := strings.Index(target, "://"); i >= 0 {
+		target = target[i+3:]
+	}
+	// The target comes from the scrape request, it must not name a
+	// directory outside of the replay directory.
+	name := filepath.Base(target)
+	if name == "." || name == ".." || name == string(filepath.Separator) {
+		level.Error(c.logger).Log("msg", "Invalid target for replay", "path", path)
+		return nil, fmt.Errorf("invalid target %q for replay", c.target)
+	}
+	dirs := []string{filepath.Join(replayDir, name), replayDir}
+	for _, dir := range dirs {
+		body, err := os.Open(filepath.Join(dir, file))
+		if os.IsNotExist(err) && dir != replayDir {
+			continue
+		}
+		if err != nil {
+			level.Error(c.logger).Log("msg", "Error reading recorded payload", "path", path, "err", err)
+			return nil, err
+		}
+		level.Debug(c.logger).Log("msg", "Replaying recorded payload", "path", path, "file", filepath.Join(dir, file))
+		return body, nil
+	}
+	return nil, os.ErrNotExist
+}
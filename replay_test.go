@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/ringsq/sansay_exporter/config"
+)
+
+func TestReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, file := range []string{"stats_realtime.xml", "stats_resource.xml", "stats_media_server.xml", "download_resource.xml"} {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, file), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// sbc2 has its own media server payload.
+	if err := os.Mkdir(filepath.Join(dir, "sbc2"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	media := `<XBMediaServerRealTimeStatList><XBMediaServerRealTimeStat><alias>ms</alias><status>up</status><maxConnections>1</maxConnections><numActiveSessions>1</numActiveSessions></XBMediaServerRealTimeStat></XBMediaServerRealTimeStatList>`
+	if err := ioutil.WriteFile(filepath.Join(dir, "sbc2", "stats_media_server.xml"), []byte(media), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	replayDir = dir
+	defer func() { replayDir = "" }()
+	module := config.DefaultModule
+	for target, mediaServers := range map[string]int{"sbc1": 8, "sbc2": 1} {
+		c, err := newCollector(context.Background(), "https://"+target, &module, nil, log.NewNopLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts := map[string]int{}
+		for _, m := range gatherMetrics(c.Collect) {
+			counts[metricName(m)]++
+		}
+		if counts["sansay_collector_success"] != 4 || counts["sansay_collector_error"] != 0 {
+			t.Errorf("%s: expected all collectors to succeed, got %d errors", target, counts["sansay_collector_error"])
+		}
+		if counts["sansay_mediaserver_up"] != mediaServers {
+			t.Errorf("%s: expected %d media servers, got %d", target, mediaServers, counts["sansay_mediaserver_up"])
+		}
+	}
+}
+
+func TestReplayInvalidTarget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	replayDir = filepath.Join(dir, "fixtures")
+	defer func() { replayDir = "" }()
+	if err := os.Mkdir(replayDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// A payload outside of the replay directory.
+	if err := ioutil.WriteFile(filepath.Join(dir, "stats_realtime.xml"), []byte("<mysqldump/>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	module := config.DefaultModule
+	for _, target := range []string{"https://..", "https://.", "", "https://sbc1/.."} {
+		c := collector{target: target, module: &module, logger: log.NewNopLogger()}
+		if body, err := readReplay(c, "stats/realtime"); err == nil {
+			body.Close()
+			t.Errorf("Expected target %q to be rejected", target)
+		}
+	}
+}
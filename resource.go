@@ -0,0 +1,116 @@
+// Copyright 2016 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ringsq/sansay_exporter/models"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// trunkInfoFields gives the values of the resource configuration fields that
+// can be selected as labels of sansay_trunk_info, see config.TrunkInfoLabels.
+var trunkInfoFields = map[string]func(*models.XBResource) string{
+	"protocol":           func(r *models.XBResource) string { return r.Protocol },
+	"port_address":       func(r *models.XBResource) string { return r.TypeSIPgw.PortAddress },
+	"direction":          func(r *models.XBResource) string { return r.TypeSIPgw.Direction },
+	"service_state":      func(r *models.XBResource) string { return r.TypeSIPgw.ServiceState },
+	"nat":                func(r *models.XBResource) string { return r.TypeSIPgw.NAT },
+	"allow_direct_media": func(r *models.XBResource) string { return r.TypeSIPgw.AllowDirectMedia },
+	"sip_profile_index":  func(r *models.XBResource) string { return r.TypeSIPgw.SipProfileIndex },
+	"option_poll":        func(r *models.XBResource) string { return r.TypeSIPgw.OptionPoll },
+	"company_name":       func(r *models.XBResource) string { return r.CompanyName },
+	"sg_id":              func(r *models.XBResource) string { return r.SgId },
+	"rtid":               func(r *models.XBResource) string { return r.Rtid },
+	"dtid":               func(r *models.XBResource) string { return r.Dtid },
+	"codec_policy":       func(r *models.XBResource) string { return r.CodecPolicy },
+	"group_policy":       func(r *models.XBResource) string { return r.GroupPolicy },
+	"tech_prefix":        func(r *models.XBResource) string { return r.TechPrefix },
+	"cause_code_profile": func(r *models.XBResource) string { return r.CauseCodeProfile },
+	"stop_route_profile": func(r *models.XBResource) string { return r.StopRouteProfile },
+}
+
+// trunkConfigGauges are the numeric settings of a resource exported as
+// gauges, by field name. Fields missing from older SBCs are skipped.
+var trunkConfigGauges = []struct {
+	field string
+	name  string
+	value func(*models.XBResource) string
+}{
+	{field: "maxCallDuration", name: "config_trunk_call_duration_max_seconds", value: func(r *models.XBResource) string { return r.MaxCallDuration }},
+	{field: "noAnswerTimeout", name: "config_trunk_no_answer_timeout_seconds", value: func(r *models.XBResource) string { return r.NoAnswerTimeout }},
+	{field: "noRingTimeout", name: "config_trunk_no_ring_timeout_seconds", value: func(r *models.XBResource) string { return r.NoRingTimeout }},
+	{field: "authorizedRPS", name: "config_trunk_authorized_requests_per_second", value: func(r *models.XBResource) string { return r.TypeSIPgw.AuthorizedRPS }},
+	{field: "unauthorizedRPS", name: "config_trunk_unauthorized_requests_per_second", value: func(r *models.XBResource) string { return r.TypeSIPgw.UnauthorizedRPS }},
+}
+
+// trunkServiceStates are the service states of a SIP trunk group always
+// exported by sansay_trunk_service_state.
+var trunkServiceStates = []string{"inservice", "outofservice"}
+
+var (
+	trunkServiceStateDesc = prometheus.NewDesc("sansay_trunk_service_state",
+		"Service state of the trunk group, 1 for the current state.",
+		[]string{"trunkgroup", "alias", "state"}, nil)
+	trunkOptionPollDesc = prometheus.NewDesc("sansay_trunk_option_poll_enabled",
+		"Whether the SBC polls the trunk group with SIP OPTIONS.",
+		[]string{"trunkgroup", "alias"}, nil)
+)
+
+// addTrunkStateMetrics creates the service state and option poll metrics of
+// a SIP trunk group. Other resources have neither.
+func (c collector) addTrunkStateMetrics(ch chan<- prometheus.Metric, resource *models.XBResource, labelValues []string) {
+	if state := strings.ToLower(strings.TrimSpace(resource.TypeSIPgw.ServiceState)); state != "" {
+		sendStateSet(ch, trunkServiceStateDesc, trunkServiceStates, state, labelValues...)
+	}
+	switch strings.ToLower(strings.TrimSpace(resource.TypeSIPgw.OptionPoll)) {
+	case "":
+	case "enable":
+		ch <- prometheus.MustNewConstMetric(trunkOptionPollDesc, prometheus.GaugeValue, 1, labelValues...)
+	case "disable":
+		ch <- prometheus.MustNewConstMetric(trunkOptionPollDesc, prometheus.GaugeValue, 0, labelValues...)
+	default:
+		c.countParseError("XBResourceList", "optionPoll", fmt.Errorf("unknown value %q", resource.TypeSIPgw.OptionPoll))
+	}
+}
+
+// addTrunkConfigMetrics creates the info metric and the gauges of the
+// settings of a resource.
+func (c collector) addTrunkConfigMetrics(ch chan<- prometheus.Metric, resource *models.XBResource, labels, labelValues []string) {
+	infoLabels := append([]string(nil), labels...)
+	infoValues := append([]string(nil), labelValues...)
+	for _, name := range c.module.TrunkInfoLabels {
+		if field, ok := trunkInfoFields[name]; ok {
+			infoLabels = append(infoLabels, name)
+			infoValues = append(infoValues, field(resource))
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc("sansay_trunk_info", "Configuration of the trunk group, with the module's trunk_info_labels as labels.", infoLabels, nil),
+		prometheus.GaugeValue,
+		1, infoValues...)
+
+	for _, gauge := range trunkConfigGauges {
+		value := strings.TrimSpace(gauge.value(resource))
+		if value == "" {
+			continue
+		}
+		if err := addLabeledMetric(ch, gauge.name, value, labels, labelValues); err != nil {
+			c.countParseError("XBResourceList", gauge.field, err)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/ringsq/sansay_exporter/config"
+	"github.com/ringsq/sansay_exporter/models"
+)
+
+func TestTrunkInfoFields(t *testing.T) {
+	for _, name := range config.TrunkInfoLabels {
+		if _, ok := trunkInfoFields[name]; !ok {
+			t.Errorf("No field for trunk info label %q", name)
+		}
+	}
+	if len(trunkInfoFields) != len(config.TrunkInfoLabels) {
+		t.Errorf("Expected %d trunk info fields, got %d", len(config.TrunkInfoLabels), len(trunkInfoFields))
+	}
+}
+
+func TestTrunkConfigMetrics(t *testing.T) {
+	payload := `<XBResourceList><XBResource><typeSIPgw><serviceState>inservice</serviceState><authorizedRPS>50</authorizedRPS></typeSIPgw>
+<name>carrier</name><trunkId>100</trunkId><rtid>7</rtid><capacity>10</capacity><cpsLimit>1</cpsLimit>
+<maxCallDuration>7200</maxCallDuration><noAnswerTimeout>bad</noAnswerTimeout></XBResource></XBResourceList>`
+	var resources models.XBResourceList
+	if err := xml.Unmarshal([]byte(payload), &resources); err != nil {
+		t.Fatal(err)
+	}
+	module := config.DefaultModule
+	module.TrunkInfoLabels = []string{"service_state", "rtid"}
+	c := collector{module: &module, logger: log.NewNopLogger()}
+	got := map[string]float64{}
+	for _, m := range gatherMetrics(func(ch chan<- prometheus.Metric) { c.processXBResourceList(ch, resources) }) {
+		got[metricKey(t, m)] = metricValue(t, m)
+	}
+	want := map[string]float64{
+		`sansay_config_trunk_sessions_max{alias="carrier",trunkgroup="100"}`:                     10,
+		`sansay_config_trunk_cps_max{alias="carrier",trunkgroup="100"}`:                          1,
+		`sansay_trunk_info{alias="carrier",rtid="7",service_state="inservice",trunkgroup="100"}`: 1,
+		`sansay_config_trunk_call_duration_max_seconds{alias="carrier",trunkgroup="100"}`:        7200,
+		`sansay_config_trunk_authorized_requests_per_second{alias="carrier",trunkgroup="100"}`:   50,
+		`sansay_trunk_service_state{alias="carrier",state="inservice",trunkgroup="100"}`:         1,
+		`sansay_trunk_service_state{alias="carrier",state="outofservice",trunkgroup="100"}`:      0,
+	}
+	if len(got) != len(want) {
+		t.Errorf("Expected %d metrics, got %v", len(want), got)
+	}
+	for key, value := range want {
+		if v, ok := got[key]; !ok || v != value {
+			t.Errorf("Expected %s %v, got %v", key, value, got)
+		}
+	}
+}
+
+func TestTrunkStateMetrics(t *testing.T) {
+	payload := `<XBResourceList>
+<XBResource><typeSIPgw><serviceState>inservice</serviceState><optionPoll>enable</optionPoll></typeSIPgw><name>a</name><trunkId>1</trunkId></XBResource>
+<XBResource><typeSIPgw><serviceState>OutOfService</serviceState><optionPoll>disable</optionPoll></typeSIPgw><name>b</name><trunkId>2</trunkId></XBResource>
+<XBResource><typeSIPgw><serviceState>testing</serviceState><optionPoll>sometimes</optionPoll></typeSIPgw><name>c</name><trunkId>3</trunkId></XBResource>
+<XBResource><name>d</name><trunkId>4</trunkId></XBResource>
+</XBResourceList>`
+	var resources models.XBResourceList
+	if err := xml.Unmarshal([]byte(payload), &resources); err != nil {
+		t.Fatal(err)
+	}
+	module := config.DefaultModule
+	c := collector{module: &module, logger: log.NewNopLogger()}
+	got := map[string]float64{}
+	for _, m := range gatherMetrics(func(ch chan<- prometheus.Metric) {
+		for i := range resources.XBResource {
+			r := &resources.XBResource[i]
+			c.addTrunkStateMetrics(ch, r, []string{r.TrunkId, r.Name})
+		}
+	}) {
+		got[metricKey(t, m)] = metricValue(t, m)
+	}
+	want := map[string]float64{
+		`sansay_trunk_service_state{alias="a",state="inservice",trunkgroup="1"}`:    1,
+		`sansay_trunk_service_state{alias="a",state="outofservice",trunkgroup="1"}`: 0,
+		`sansay_trunk_option_poll_enabled{alias="a",trunkgroup="1"}`:                1,
+		`sansay_trunk_service_state{alias="b",state="inservice",trunkgroup="2"}`:    0,
+		`sansay_trunk_service_state{alias="b",state="outofservice",trunkgroup="2"}`: 1,
+		`sansay_trunk_option_poll_enabled{alias="b",trunkgroup="2"}`:                0,
+		`sansay_trunk_service_state{alias="c",state="inservice",trunkgroup="3"}`:    0,
+		`sansay_trunk_service_state{alias="c",state="outofservice",trunkgroup="3"}`: 0,
+		`sansay_trunk_service_state{alias="c",state="testing",trunkgroup="3"}`:      1,
+	}
+	if len(got) != len(want) {
+		t.Errorf("Expected %d metrics, got %v", len(want), got)
+	}
+	for key, value := range want {
+		if v, ok := got[key]; !ok || v != value {
+			t.Errorf("Expected %s %v, got %v", key, value, got)
+		}
+	}
+}
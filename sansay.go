@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/xml"
 	"github.com/hooklift/gowsdl/soap"
 	"time"
@@ -293,27 +294,51 @@ type SystemStatsResult struct {
 type SansayWS interface {
 	DoUploadXmlFile(request *UploadParams) (*UploadResult, error)
 
+	DoUploadXmlFileContext(ctx context.Context, request *UploadParams) (*UploadResult, error)
+
 	DoReplaceLarge(request *ReplaceLargeParams) (*ReplaceResult, error)
 
+	DoReplaceLargeContext(ctx context.Context, request *ReplaceLargeParams) (*ReplaceResult, error)
+
 	DoDelete(request *DeleteParams) (*DeleteResult, error)
 
+	DoDeleteContext(ctx context.Context, request *DeleteParams) (*DeleteResult, error)
+
 	DoDeleteLarge(request *DeleteLargeParams) (*DeleteResult, error)
 
+	DoDeleteLargeContext(ctx context.Context, request *DeleteLargeParams) (*DeleteResult, error)
+
 	DoUpdate(request *UpdateParams) (*UpdateResult, error)
 
+	DoUpdateContext(ctx context.Context, request *UpdateParams) (*UpdateResult, error)
+
 	DoUpdateLarge(request *UpdateLargeParams) (*UpdateResult, error)
 
+	DoUpdateLargeContext(ctx context.Context, request *UpdateLargeParams) (*UpdateResult, error)
+
 	DoDownloadXmlFile(request *DownloadParams) (*DownloadResult, error)
 
+	DoDownloadXmlFileContext(ctx context.Context, request *DownloadParams) (*DownloadResult, error)
+
 	DoDownloadLargeXmlFile(request *DownloadLargeParams) (*DownloadLargeResult, error)
 
+	DoDownloadLargeXmlFileContext(ctx context.Context, request *DownloadLargeParams) (*DownloadLargeResult, error)
+
 	DoQueryXmlFile(request *QueryParams) (*QueryResult, error)
 
+	DoQueryXmlFileContext(ctx context.Context, request *QueryParams) (*QueryResult, error)
+
 	DoRouteLookup(request *RoutelookupParams) (*RoutelookupResult, error)
 
+	DoRouteLookupContext(ctx context.Context, request *RoutelookupParams) (*RoutelookupResult, error)
+
 	DoRealTimeStats(request *RealTimeStatsParams) (*RealTimeStatsResult, error)
 
+	DoRealTimeStatsContext(ctx context.Context, request *RealTimeStatsParams) (*RealTimeStatsResult, error)
+
 	DoSystemStats(request *SystemStatsParams) (*SystemStatsResult, error)
+
+	DoSystemStatsContext(ctx context.Context, request *SystemStatsParams) (*SystemStatsResult, error)
 }
 
 type sansayWS struct {
@@ -326,9 +351,9 @@ func NewSansayWS(client *soap.Client) SansayWS {
 	}
 }
 
-func (service *sansayWS) DoUploadXmlFile(request *UploadParams) (*UploadResult, error) {
+func (service *sansayWS) DoUploadXmlFileContext(ctx context.Context, request *UploadParams) (*UploadResult, error) {
 	response := new(UploadResult)
-	err := service.client.Call("", request, response)
+	err := service.client.CallContext(ctx, "", request, response)
 	if err != nil {
 		return nil, err
 	}
@@ -336,9 +361,16 @@ func (service *sansayWS) DoUploadXmlFile(request *UploadParams) (*UploadResult,
 	return response, nil
 }
 
-func (service *sansayWS) DoReplaceLarge(request *ReplaceLargeParams) (*ReplaceResult, error) {
+func (service *sansayWS) DoUploadXmlFile(request *UploadParams) (*UploadResult, error) {
+	return service.DoUploadXmlFileContext(
+		context.Background(),
+		request,
+	)
+}
+
+func (service *sansayWS) DoReplaceLargeContext(ctx context.Context, request *ReplaceLargeParams) (*ReplaceResult, error) {
 	response := new(ReplaceResult)
-	err := service.client.Call("", request, response)
+	err := service.client.CallContext(ctx, "", request, response)
 	if err != nil {
 		return nil, err
 	}
@@ -346,9 +378,16 @@ func (service *sansayWS) DoReplaceLarge(request *ReplaceLargeParams) (*ReplaceRe
 	return response, nil
 }
 
-func (service *sansayWS) DoDelete(request *DeleteParams) (*DeleteResult, error) {
+func (service *sansayWS) DoReplaceLarge(request *ReplaceLargeParams) (*ReplaceResult, error) {
+	return service.DoReplaceLargeContext(
+		context.Background(),
+		request,
+	)
+}
+
+func (service *sansayWS) DoDeleteContext(ctx context.Context, request *DeleteParams) (*DeleteResult, error) {
 	response := new(DeleteResult)
-	err := service.client.Call("", request, response)
+	err := service.client.CallContext(ctx, "", request, response)
 	if err != nil {
 		return nil, err
 	}
@@ -356,9 +395,16 @@ func (service *sansayWS) DoDelete(request *DeleteParams) (*DeleteResult, error)
 	return response, nil
 }
 
-func (service *sansayWS) DoDeleteLarge(request *DeleteLargeParams) (*DeleteResult, error) {
+func (service *sansayWS) DoDelete(request *DeleteParams) (*DeleteResult, error) {
+	return service.DoDeleteContext(
+		context.Background(),
+		request,
+	)
+}
+
+func (service *sansayWS) DoDeleteLargeContext(ctx context.Context, request *DeleteLargeParams) (*DeleteResult, error) {
 	response := new(DeleteResult)
-	err := service.client.Call("", request, response)
+	err := service.client.CallContext(ctx, "", request, response)
 	if err != nil {
 		return nil, err
 	}
@@ -366,9 +412,16 @@ func (service *sansayWS) DoDeleteLarge(request *DeleteLargeParams) (*DeleteResul
 	return response, nil
 }
 
-func (service *sansayWS) DoUpdate(request *UpdateParams) (*UpdateResult, error) {
+func (service *sansayWS) DoDeleteLarge(request *DeleteLargeParams) (*DeleteResult, error) {
+	return service.DoDeleteLargeContext(
+		context.Background(),
+		request,
+	)
+}
+
+func (service *sansayWS) DoUpdateContext(ctx context.Context, request *UpdateParams) (*UpdateResult, error) {
 	response := new(UpdateResult)
-	err := service.client.Call("", request, response)
+	err := service.client.CallContext(ctx, "", request, response)
 	if err != nil {
 		return nil, err
 	}
@@ -376,9 +429,16 @@ func (service *sansayWS) DoUpdate(request *UpdateParams) (*UpdateResult, error)
 	return response, nil
 }
 
-func (service *sansayWS) DoUpdateLarge(request *UpdateLargeParams) (*UpdateResult, error) {
+func (service *sansayWS) DoUpdate(request *UpdateParams) (*UpdateResult, error) {
+	return service.DoUpdateContext(
+		context.Background(),
+		request,
+	)
+}
+
+func (service *sansayWS) DoUpdateLargeContext(ctx context.Context, request *UpdateLargeParams) (*UpdateResult, error) {
 	response := new(UpdateResult)
-	err := service.client.Call("", request, response)
+	err := service.client.CallContext(ctx, "", request, response)
 	if err != nil {
 		return nil, err
 	}
@@ -386,9 +446,16 @@ func (service *sansayWS) DoUpdateLarge(request *UpdateLargeParams) (*UpdateResul
 	return response, nil
 }
 
-func (service *sansayWS) DoDownloadXmlFile(request *DownloadParams) (*DownloadResult, error) {
+func (service *sansayWS) DoUpdateLarge(request *UpdateLargeParams) (*UpdateResult, error) {
+	return service.DoUpdateLargeContext(
+		context.Background(),
+		request,
+	)
+}
+
+func (service *sansayWS) DoDownloadXmlFileContext(ctx context.Context, request *DownloadParams) (*DownloadResult, error) {
 	response := new(DownloadResult)
-	err := service.client.Call("", request, response)
+	err := service.client.CallContext(ctx, "", request, response)
 	if err != nil {
 		return nil, err
 	}
@@ -396,9 +463,16 @@ func (service *sansayWS) DoDownloadXmlFile(request *DownloadParams) (*DownloadRe
 	return response, nil
 }
 
-func (service *sansayWS) DoDownloadLargeXmlFile(request *DownloadLargeParams) (*DownloadLargeResult, error) {
+func (service *sansayWS) DoDownloadXmlFile(request *DownloadParams) (*DownloadResult, error) {
+	return service.DoDownloadXmlFileContext(
+		context.Background(),
+		request,
+	)
+}
+
+func (service *sansayWS) DoDownloadLargeXmlFileContext(ctx context.Context, request *DownloadLargeParams) (*DownloadLargeResult, error) {
 	response := new(DownloadLargeResult)
-	err := service.client.Call("", request, response)
+	err := service.client.CallContext(ctx, "", request, response)
 	if err != nil {
 		return nil, err
 	}
@@ -406,9 +480,16 @@ func (service *sansayWS) DoDownloadLargeXmlFile(request *DownloadLargeParams) (*
 	return response, nil
 }
 
-func (service *sansayWS) DoQueryXmlFile(request *QueryParams) (*QueryResult, error) {
+func (service *sansayWS) DoDownloadLargeXmlFile(request *DownloadLargeParams) (*DownloadLargeResult, error) {
+	return service.DoDownloadLargeXmlFileContext(
+		context.Background(),
+		request,
+	)
+}
+
+func (service *sansayWS) DoQueryXmlFileContext(ctx context.Context, request *QueryParams) (*QueryResult, error) {
 	response := new(QueryResult)
-	err := service.client.Call("", request, response)
+	err := service.client.CallContext(ctx, "", request, response)
 	if err != nil {
 		return nil, err
 	}
@@ -416,9 +497,16 @@ func (service *sansayWS) DoQueryXmlFile(request *QueryParams) (*QueryResult, err
 	return response, nil
 }
 
-func (service *sansayWS) DoRouteLookup(request *RoutelookupParams) (*RoutelookupResult, error) {
+func (service *sansayWS) DoQueryXmlFile(request *QueryParams) (*QueryResult, error) {
+	return service.DoQueryXmlFileContext(
+		context.Background(),
+		request,
+	)
+}
+
+func (service *sansayWS) DoRouteLookupContext(ctx context.Context, request *RoutelookupParams) (*RoutelookupResult, error) {
 	response := new(RoutelookupResult)
-	err := service.client.Call("", request, response)
+	err := service.client.CallContext(ctx, "", request, response)
 	if err != nil {
 		return nil, err
 	}
@@ -426,9 +514,16 @@ func (service *sansayWS) DoRouteLookup(request *RoutelookupParams) (*Routelookup
 	return response, nil
 }
 
-func (service *sansayWS) DoRealTimeStats(request *RealTimeStatsParams) (*RealTimeStatsResult, error) {
+func (service *sansayWS) DoRouteLookup(request *RoutelookupParams) (*RoutelookupResult, error) {
+	return service.DoRouteLookupContext(
+		context.Background(),
+		request,
+	)
+}
+
+func (service *sansayWS) DoRealTimeStatsContext(ctx context.Context, request *RealTimeStatsParams) (*RealTimeStatsResult, error) {
 	response := new(RealTimeStatsResult)
-	err := service.client.Call("", request, response)
+	err := service.client.CallContext(ctx, "", request, response)
 	if err != nil {
 		return nil, err
 	}
@@ -436,12 +531,26 @@ func (service *sansayWS) DoRealTimeStats(request *RealTimeStatsParams) (*RealTim
 	return response, nil
 }
 
-func (service *sansayWS) DoSystemStats(request *SystemStatsParams) (*SystemStatsResult, error) {
+func (service *sansayWS) DoRealTimeStats(request *RealTimeStatsParams) (*RealTimeStatsResult, error) {
+	return service.DoRealTimeStatsContext(
+		context.Background(),
+		request,
+	)
+}
+
+func (service *sansayWS) DoSystemStatsContext(ctx context.Context, request *SystemStatsParams) (*SystemStatsResult, error) {
 	response := new(SystemStatsResult)
-	err := service.client.Call("", request, response)
+	err := service.client.CallContext(ctx, "", request, response)
 	if err != nil {
 		return nil, err
 	}
 
 	return response, nil
 }
+
+func (service *sansayWS) DoSystemStats(request *SystemStatsParams) (*SystemStatsResult, error) {
+	return service.DoSystemStatsContext(
+		context.Background(),
+		request,
+	)
+}
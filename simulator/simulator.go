@@ -0,0 +1,393 @@
+// Copyright 2016 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package simulator serves the REST and SOAP APIs of a Sansay SBC from
+// fixture files, for testing the exporter without an SBC.
+package simulator
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/ringsq/sansay_exporter/fixture"
+)
+
+// Paths of the APIs, as used by the SBC.
+const (
+	RestPath = "/SSConfig/webresources/"
+	SoapPath = "/SSConfig/SansayWS"
+)
+
+// Kinds of errors the simulator can inject.
+const (
+	ErrorStatus  = "status"
+	ErrorFault   = "fault"
+	ErrorRetCode = "retcode"
+	ErrorEmpty   = "empty"
+)
+
+// ErrorKinds lists the kinds of errors the simulator can inject.
+var ErrorKinds = []string{ErrorStatus, ErrorFault, ErrorRetCode, ErrorEmpty}
+
+// Config configures a simulated SBC.
+type Config struct {
+	// Directory holding the fixture files.
+	FixturesDir string
+	// Credentials required by the APIs. No credentials are required when
+	// Username is empty.
+	Username string
+	Password string
+	// Delay added to every response.
+	Latency time.Duration
+	// Fraction of requests answered with an error of ErrorKind.
+	ErrorRate float64
+	ErrorKind string
+	// Number of resources per page of SOAP downloads, 0 for a single page.
+	PageSize int
+	// Answer REST requests with 404, like SBCs only offering SOAP.
+	DisableREST bool
+}
+
+// Simulator is an http.Handler simulating a Sansay SBC.
+type Simulator struct {
+	cfg    Config
+	logger log.Logger
+
+	mtx  sync.Mutex
+	rand *rand.Rand
+}
+
+// New returns a simulator serving the fixtures of cfg.
+func New(cfg Config, logger log.Logger) (*Simulator, error) {
+	if cfg.ErrorRate > 0 {
+		valid := false
+		for _, kind := range ErrorKinds {
+			valid = valid || kind == cfg.ErrorKind
+		}
+		if !valid {
+			return nil, fmt.Errorf("unknown error kind %q", cfg.ErrorKind)
+		}
+	}
+	return &Simulator{
+		cfg:    cfg,
+		logger: logger,
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Simulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.Latency > 0 {
+		select {
+		case <-time.After(s.cfg.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	switch {
+	case strings.HasPrefix(r.URL.Path, RestPath) && !s.cfg.DisableREST:
+		s.serveREST(w, r, strings.TrimPrefix(r.URL.Path, RestPath))
+	case r.URL.Path == SoapPath && r.Method == http.MethodPost:
+		s.serveSOAP(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// injectError returns whether the current request should fail.
+func (s *Simulator) injectError() bool {
+	if s.cfg.ErrorRate <= 0 {
+		return false
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.rand.Float64() < s.cfg.ErrorRate
+}
+
+func (s *Simulator) authorized(username, password string) bool {
+	return s.cfg.Username == "" || username == s.cfg.Username && password == s.cfg.Password
+}
+
+func (s *Simulator) fixture(path string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(s.cfg.FixturesDir, fixture.File(path)))
+}
+
+func (s *Simulator) serveREST(w http.ResponseWriter, r *http.Request, path string) {
+	username, password, _ := r.BasicAuth()
+	if !s.authorized(username, password) {
+		level.Debug(s.logger).Log("msg", "Rejected REST request", "path", path)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if s.injectError() {
+		level.Debug(s.logger).Log("msg", "Injecting error", "path", path, "kind", s.cfg.ErrorKind)
+		if s.cfg.ErrorKind != ErrorEmpty {
+			http.Error(w, "Simulated error", http.StatusInternalServerError)
+		}
+		return
+	}
+	data, err := s.fixture(path)
+	if err != nil {
+		level.Debug(s.logger).Log("msg", "No fixture for REST request", "path", path, "err", err)
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write(data)
+}
+
+// soapParams holds the parameters of the SOAP operations used by the exporter.
+type soapParams struct {
+	XMLName     xml.Name
+	Username    string `xml:"username"`
+	Password    string `xml:"password"`
+	StatName    string `xml:"statName"`
+	SysStatName string `xml:"sysStatName"`
+	Table       string `xml:"table"`
+	Page        int    `xml:"page"`
+}
+
+// soapResult is the reply to a SOAP operation.
+type soapResult struct {
+	XMLName xml.Name
+	RetCode int    `xml:"retCode"`
+	Msg     string `xml:"msg,omitempty"`
+	Xmlfile string `xml:"xmlfile,omitempty"`
+	Binfile string `xml:"binfile,omitempty"`
+	HasMore int    `xml:"hasMore,omitempty"`
+}
+
+type soapFault struct {
+	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Fault"`
+	Code    string   `xml:"faultcode"`
+	String  string   `xml:"faultstring"`
+}
+
+type soapEnvelope struct {
+	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
+	Body    struct {
+		Content interface{}
+	} `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
+}
+
+const sansayNamespace = "http://ws.sansay.com"
+
+func (s *Simulator) serveSOAP(w http.ResponseWriter, r *http.Request) {
+	params, err := decodeSOAPRequest(r)
+	if err != nil {
+		level.Debug(s.logger).Log("msg", "Invalid SOAP request", "err", err)
+		s.writeSOAP(w, http.StatusInternalServerError, soapFault{Code: "soap:Client", String: err.Error()})
+		return
+	}
+	operation := params.XMLName.Local
+	result := soapResult{XMLName: xml.Name{Space: sansayNamespace, Local: strings.TrimSuffix(operation, "Params") + "Result"}}
+	if !s.authorized(params.Username, params.Password) {
+		level.Debug(s.logger).Log("msg", "Rejected SOAP request", "operation", operation)
+		result.RetCode = 1
+		result.Msg = "Invalid username or password"
+		s.writeSOAP(w, http.StatusOK, result)
+		return
+	}
+	if s.injectError() {
+		level.Debug(s.logger).Log("msg", "Injecting error", "operation", operation, "kind", s.cfg.ErrorKind)
+		switch s.cfg.ErrorKind {
+		case ErrorStatus:
+			http.Error(w, "Simulated error", http.StatusInternalServerError)
+		case ErrorFault:
+			s.writeSOAP(w, http.StatusInternalServerError, soapFault{Code: "soap:Server", String: "Simulated fault"})
+		case ErrorRetCode:
+			result.RetCode = 1
+			result.Msg = "Simulated error"
+			s.writeSOAP(w, http.StatusOK, result)
+		case ErrorEmpty:
+			s.writeSOAP(w, http.StatusOK, result)
+		}
+		return
+	}
+
+	var path string
+	switch operation {
+	case "realTimeStatsParams":
+		path = "stats/" + params.StatName
+	case "downloadParams", "downloadLargeParams":
+		path = "download/" + params.Table
+	case "SystemStatsParams":
+		path = "stats/system"
+	default:
+		s.writeSOAP(w, http.StatusInternalServerError, soapFault{Code: "soap:Client", String: "Unsupported operation " + operation})
+		return
+	}
+	data, err := s.fixture(path)
+	if err != nil {
+		level.Debug(s.logger).Log("msg", "No fixture for SOAP request", "path", path, "err", err)
+		result.RetCode = 1
+		result.Msg = "No data for " + path
+		s.writeSOAP(w, http.StatusOK, result)
+		return
+	}
+	switch operation {
+	case "downloadParams":
+		var hasMore bool
+		data, hasMore, err = page(data, params.Page, s.cfg.PageSize)
+		if err != nil {
+			s.writeSOAP(w, http.StatusInternalServerError, soapFault{Code: "soap:Server", String: err.Error()})
+			return
+		}
+		if hasMore {
+			result.HasMore = 1
+		}
+		result.Xmlfile = string(data)
+	case "downloadLargeParams":
+		result.Binfile = base64.StdEncoding.EncodeToString(data)
+	case "SystemStatsParams":
+		// The fixture holds all the system statistics, as served over REST.
+		data, err = table(data, params.SysStatName+"_stat")
+		if err != nil {
+			level.Debug(s.logger).Log("msg", "No system statistic", "name", params.SysStatName, "err", err)
+			result.RetCode = 1
+			result.Msg = "Unknown system statistic " + params.SysStatName
+			break
+		}
+		result.Xmlfile = string(data)
+	default:
+		result.Xmlfile = string(data)
+	}
+	s.writeSOAP(w, http.StatusOK, result)
+}
+
+// decodeSOAPRequest returns the parameters of the operation in the body of
+// a SOAP request.
+func decodeSOAPRequest(r *http.Request) (soapParams, error) {
+	var params soapParams
+	d := xml.NewDecoder(r.Body)
+	inBody := false
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return params, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if inBody {
+			err := d.DecodeElement(&params, &start)
+			return params, err
+		}
+		inBody = start.Name.Local == "Body"
+	}
+}
+
+func (s *Simulator) writeSOAP(w http.ResponseWriter, status int, content interface{}) {
+	var env soapEnvelope
+	env.Body.Content = content
+	data, err := xml.Marshal(env)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+}
+
+// page returns the elements of page n of the document, with size elements of
+// the root per page, and whether more pages follow. A size of 0 puts all the
+// elements on the first page.
+func page(data []byte, n, size int) ([]byte, bool, error) {
+	if size <= 0 {
+		if n > 0 {
+			return nil, false, nil
+		}
+		return data, false, nil
+	}
+	var (
+		root     xml.StartElement
+		elements [][]byte
+		depth    int
+		offset   int64
+	)
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 1 {
+				root = t.Copy()
+			} else if depth == 2 {
+				if err := d.Skip(); err != nil {
+					return nil, false, err
+				}
+				depth--
+				elements = append(elements, data[offset:d.InputOffset()])
+			}
+		case xml.EndElement:
+			depth--
+		}
+		offset = d.InputOffset()
+	}
+	if root.Name.Local == "" {
+		return nil, false, fmt.Errorf("fixture has no root element")
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<%s>", root.Name.Local)
+	for i := n * size; i < (n+1)*size && i < len(elements); i++ {
+		buf.Write(elements[i])
+	}
+	fmt.Fprintf(&buf, "</%s>", root.Name.Local)
+	return buf.Bytes(), (n+1)*size < len(elements), nil
+}
+
+// table returns a mysqldump document holding only the named table of data.
+func table(data []byte, name string) ([]byte, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	offset := d.InputOffset()
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, fmt.Errorf("no table %q in fixture: %w", name, err)
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local == "table" {
+			if err := d.Skip(); err != nil {
+				return nil, err
+			}
+			for _, attr := range start.Attr {
+				if attr.Name.Local == "name" && attr.Value == name {
+					var buf bytes.Buffer
+					buf.WriteString(`<mysqldump><database name="sansay">`)
+					buf.Write(data[offset:d.InputOffset()])
+					buf.WriteString(`</database></mysqldump>`)
+					return buf.Bytes(), nil
+				}
+			}
+		}
+		offset = d.InputOffset()
+	}
+}
@@ -0,0 +1,78 @@
+package simulator
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestServeREST(t *testing.T) {
+	sim, err := New(Config{FixturesDir: "../testdata", Username: "user", Password: "pass"}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(sim)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + RestPath + "stats/realtime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without credentials, got %d", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest("GET", server.URL+RestPath+"stats/realtime", nil)
+	req.SetBasicAuth("user", "pass")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "<mysqldump") {
+		t.Errorf("Unexpected response %d: %.100s", resp.StatusCode, body)
+	}
+}
+
+func TestServeRESTErrors(t *testing.T) {
+	if _, err := New(Config{ErrorRate: 1, ErrorKind: "unknown"}, log.NewNopLogger()); err == nil {
+		t.Error("Expected an error for an unknown error kind")
+	}
+	sim, err := New(Config{FixturesDir: "../testdata", ErrorRate: 1, ErrorKind: ErrorStatus}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	sim.ServeHTTP(rec, httptest.NewRequest("GET", RestPath+"stats/realtime", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected an injected error, got status %d", rec.Code)
+	}
+}
+
+func TestPage(t *testing.T) {
+	data := []byte(`<?xml version="1.0"?><list><item>1</item><item>2</item><item>3</item></list>`)
+	tests := []struct {
+		n, size int
+		want    string
+		hasMore bool
+	}{
+		{n: 0, size: 2, want: "<list><item>1</item><item>2</item></list>", hasMore: true},
+		{n: 1, size: 2, want: "<list><item>3</item></list>", hasMore: false},
+		{n: 0, size: 0, want: string(data), hasMore: false},
+	}
+	for _, tt := range tests {
+		got, hasMore, err := page(data, tt.n, tt.size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want || hasMore != tt.hasMore {
+			t.Errorf("page(%d, %d) = %q, %v, want %q, %v", tt.n, tt.size, got, hasMore, tt.want, tt.hasMore)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2016 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// systemStatNames are the system statistics requested with DoSystemStats over
+// SOAP, one call each. The REST API returns them all from stats/system.
+var systemStatNames = []string{"cpu", "memory", "disk", "process"}
+
+// systemTables maps the tables of the system statistics to the fields used as
+// labels, and the names of the labels.
+var systemTables = map[string]map[string]string{
+	"cpu_stat":     {"cpu": "cpu"},
+	"memory_stat":  {},
+	"disk_stat":    {"mount": "mountpoint", "device": "device"},
+	"process_stat": {"name": "process"},
+}
+
+// systemUnits converts the units of the system statistics, given by the
+// suffix of the field names, to base units.
+var systemUnits = []struct {
+	suffix string
+	unit   string
+	scale  float64
+}{
+	{suffix: "_kb", unit: "_bytes", scale: 1024},
+	{suffix: "_pct", unit: "_ratio", scale: 0.01},
+	{suffix: "_sec", unit: "_seconds", scale: 1},
+}
+
+// systemStats requests the system statistics over SOAP and merges their
+// tables into one payload. Statistics the SBC does not offer are skipped.
+func systemStats(ctx context.Context, c collector, service SansayWS, path string) ([]byte, error) {
+	var (
+		buf     bytes.Buffer
+		found   int
+		retCode int32
+		msg     string
+	)
+	buf.WriteString(`<mysqldump><database name="sansay">`)
+	for _, name := range systemStatNames {
+		params := &SystemStatsParams{
+			Username:    c.module.Username,
+			Password:    string(c.module.Password),
+			SysStatName: name,
+		}
+		reply, err := service.DoSystemStatsContext(ctx, params)
+		if err != nil {
+			return nil, soapCallError(c, path, err)
+		}
+		if reply.RetCode != 0 {
+			level.Debug(c.logger).Log("msg", "System statistic not available", "name", name, "ret_code", reply.RetCode, "sbc_msg", reply.Msg)
+			retCode, msg = reply.RetCode, reply.Msg
+			continue
+		}
+		tables, err := rawElements([]byte(reply.Xmlfile), "table")
+		if err != nil {
+			return nil, &parseError{err: fmt.Errorf("system statistic %s: %w", name, err)}
+		}
+		for _, table := range tables {
+			buf.Write(table)
+		}
+		found += len(tables)
+	}
+	if found == 0 {
+		if retCode != 0 {
+			return nil, soapRetCodeError(c, path, retCode, msg)
+		}
+		level.Error(c.logger).Log("msg", "Empty payload from SOAP API", "path", path)
+		return nil, &emptyPayloadError{}
+	}
+	buf.WriteString(`</database></mysqldump>`)
+	return buf.Bytes(), nil
+}
+
+// rawElements returns the elements of an XML payload named name as they are.
+func rawElements(data []byte, name string) ([][]byte, error) {
+	var elements [][]byte
+	d := xml.NewDecoder(bytes.NewReader(data))
+	offset := d.InputOffset()
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return elements, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local == name {
+			if err := d.Skip(); err != nil {
+				return nil, err
+			}
+			elements = append(elements, data[offset:d.InputOffset()])
+		}
+		offset = d.InputOffset()
+	}
+}
+
+// addSystemMetrics creates the metrics for a row of a table of system
+// statistics. Fields named with a unit suffix are converted to base units,
+// e.g. total_kb of memory_stat is exported as sansay_system_memory_total_bytes.
+func (c collector) addSystemMetrics(ch chan<- prometheus.Metric, table string, row []statsField) {
+	stat := strings.TrimSuffix(table, "_stat")
+	labelFields := systemTables[table]
+	fields := make([]string, 0, len(labelFields))
+	for field := range labelFields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	labels := make([]string, len(fields))
+	for i, field := range fields {
+		labels[i] = labelFields[field]
+	}
+
+	labelValues := make([]string, len(fields))
+	for _, field := range row {
+		for i, name := range fields {
+			if field.name == name {
+				labelValues[i] = field.value
+			}
+		}
+	}
+	for _, field := range row {
+		if _, ok := labelFields[field.name]; ok {
+			continue
+		}
+		value, err := strconv.ParseFloat(field.value, 64)
+		if err != nil {
+			c.reportParseError(ch, table, field.name, err)
+			continue
+		}
+		name := field.name
+		for _, unit := range systemUnits {
+			if strings.HasSuffix(name, unit.suffix) {
+				name = strings.TrimSuffix(name, unit.suffix) + unit.unit
+				value *= unit.scale
+				break
+			}
+		}
+		metric, err := prometheus.NewConstMetric(
+			prometheus.NewDesc(fmt.Sprintf("sansay_system_%s_%s", stat, name), "", labels, nil),
+			prometheus.GaugeValue,
+			value, labelValues...)
+		if err != nil {
+			c.reportParseError(ch, table, field.name, err)
+			continue
+		}
+		ch <- metric
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/ringsq/sansay_exporter/config"
+	"github.com/ringsq/sansay_exporter/simulator"
+)
+
+func TestSystemMetrics(t *testing.T) {
+	module := config.DefaultModule
+	c := collector{module: &module, logger: log.NewNopLogger()}
+	got := map[string]float64{}
+	for _, m := range gatherMetrics(func(ch chan<- prometheus.Metric) {
+		if err := c.processStats(ch, bytes.NewReader(readFixture(t, "stats_system.xml"))); err != nil {
+			t.Error(err)
+		}
+	}) {
+		got[metricKey(t, m)] = metricValue(t, m)
+	}
+	for key, want := range map[string]float64{
+		`sansay_system_cpu_user_ratio{cpu="all"}`:                                  0.125,
+		`sansay_system_memory_total_bytes{}`:                                       16318496 * 1024,
+		`sansay_system_disk_avail_bytes{device="/dev/sda3",mountpoint="/var/log"}`: 57694420 * 1024,
+		`sansay_system_process_threads{process="ssw"}`:                             64,
+		`sansay_system_process_uptime_seconds{process="mysqld"}`:                   1209650,
+	} {
+		if got[key] != want {
+			t.Errorf("Expected %s %v, got %v", key, want, got[key])
+		}
+	}
+	if len(got) != 12+6+6+8 {
+		t.Errorf("Expected %d metrics, got %d", 12+6+6+8, len(got))
+	}
+}
+
+func TestSystemStatsSOAP(t *testing.T) {
+	// Only CPU statistics are offered by this SBC.
+	dir, err := ioutil.TempDir("", "system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fixture := `<mysqldump><database name="sansay"><table name="cpu_stat"><row><field name="cpu">all</field><field name="idle_pct">90</field></row></table></database></mysqldump>`
+	if err := ioutil.WriteFile(filepath.Join(dir, "stats_system.xml"), []byte(fixture), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sim, err := simulator.New(simulator.Config{FixturesDir: dir, Username: "user", Password: "pass"}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(sim)
+	defer server.Close()
+
+	module := config.DefaultModule
+	module.API = apiSOAP
+	module.Username = "user"
+	module.Password = "pass"
+	c, err := newCollector(context.Background(), server.URL, &module, nil, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := readAPI(context.Background(), c, "stats/system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tables []string
+	err = decodeStats(bytes.NewReader(body), func(table string, fields []statsField) {
+		tables = append(tables, table)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 1 || tables[0] != "cpu_stat" {
+		t.Errorf("Unexpected tables in merged payload: %s", body)
+	}
+
+	module.Password = "wrong"
+	_, err = callAPI(context.Background(), c, "stats/system")
+	var retCodeErr *retCodeError
+	if !errors.As(err, &retCodeErr) {
+		t.Errorf("Expected a ret_code error when no statistic is available, got %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2016 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/ringsq/sansay_exporter/config"
+)
+
+var (
+	clientConnections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sansay_client_connections_total",
+			Help: "Connections used for requests to Sansay targets, by whether they were reused",
+		},
+		[]string{"reused"},
+	)
+	clientTLSHandshake = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "sansay_client_tls_handshake_seconds",
+			Help:    "Duration of TLS handshakes with Sansay targets",
+			Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		},
+	)
+	clientPoolTargets = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "sansay_client_pool_targets",
+			Help: "Targets with a pooled HTTP client",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(clientConnections)
+	prometheus.MustRegister(clientTLSHandshake)
+	prometheus.MustRegister(clientPoolTargets)
+}
+
+// targetTransport is the http.RoundTripper used for all requests to a target.
+// It keeps connections to the target alive between scrapes and remembers the
+// earliest expiry of the certificates served by the target.
+type targetTransport struct {
+	next http.RoundTripper
+
+	mtx      sync.Mutex
+	expiry   time.Time
+	lastUsed time.Time
+}
+
+func newTargetTransport(tlsConfig *tls.Config, idleTimeout time.Duration) *targetTransport {
+	return &targetTransport{
+		next: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			TLSClientConfig:     tlsConfig,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConnsPerHost: 4,
+			IdleConnTimeout:     idleTimeout,
+			ForceAttemptHTTP2:   true,
+		},
+		lastUsed: time.Now(),
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *targetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mtx.Lock()
+	t.lastUsed = time.Now()
+	t.mtx.Unlock()
+
+	var handshakeStart time.Time
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			clientConnections.WithLabelValues(strconv.FormatBool(info.Reused)).Inc()
+		},
+		TLSHandshakeStart: func() {
+			handshakeStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			clientTLSHandshake.Observe(time.Since(handshakeStart).Seconds())
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	// The SOAP client asks for the connection to be closed after every call.
+	req.Close = false
+
+	resp, err := t.next.RoundTrip(req)
+	if err == nil && resp.TLS != nil {
+		t.observe(resp.TLS)
+	}
+	return resp, err
+}
+
+func (t *targetTransport) observe(state *tls.ConnectionState) {
+	var expiry time.Time
+	for _, cert := range state.PeerCertificates {
+		if expiry.IsZero() || cert.NotAfter.Before(expiry) {
+			expiry = cert.NotAfter
+		}
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.expiry = expiry
+}
+
+// Expiry returns the earliest expiry of the certificates last served by the
+// target, if a TLS connection was made.
+func (t *targetTransport) Expiry() (time.Time, bool) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.expiry, !t.expiry.IsZero()
+}
+
+func (t *targetTransport) idleSince() time.Time {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.lastUsed
+}
+
+// CloseIdleConnections closes the connections to the target that are not in use.
+func (t *targetTransport) CloseIdleConnections() {
+	if tr, ok := t.next.(*http.Transport); ok {
+		tr.CloseIdleConnections()
+	}
+}
+
+// clientPool hands out one targetTransport per target and module, and evicts
+// the transports of targets that have not been scraped for a while.
+type clientPool struct {
+	idleTimeout time.Duration
+	ttl         time.Duration
+
+	mtx        sync.Mutex
+	transports map[string]*targetTransport
+}
+
+func newClientPool(idleTimeout, ttl time.Duration) *clientPool {
+	return &clientPool{
+		idleTimeout: idleTimeout,
+		ttl:         ttl,
+		transports:  map[string]*targetTransport{},
+	}
+}
+
+// get returns the transport for requests to target with the settings of module.
+func (p *clientPool) get(target string, module *config.Module) (*targetTransport, error) {
+	key := fmt.Sprintf("%s|%p", target, module)
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.evict()
+	if t, ok := p.transports[key]; ok {
+		return t, nil
+	}
+	tlsConfig, err := config.NewTLSConfig(&module.TLSConfig)
+	if err != nil {
+		return nil, err
+	}
+	t := newTargetTransport(tlsConfig, p.idleTimeout)
+	p.transports[key] = t
+	clientPoolTargets.Set(float64(len(p.transports)))
+	return t, nil
+}
+
+// evict drops the transports not used within the TTL. p.mtx must be held.
+func (p *clientPool) evict() {
+	for key, t := range p.transports {
+		if time.Since(t.idleSince()) > p.ttl {
+			t.CloseIdleConnections()
+			delete(p.transports, key)
+		}
+	}
+	clientPoolTargets.Set(float64(len(p.transports)))
+}
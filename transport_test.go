@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ringsq/sansay_exporter/config"
+)
+
+func TestClientPoolReusesTransport(t *testing.T) {
+	var newConns int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	server.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&newConns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	module := config.DefaultModule
+	pool := newClientPool(time.Minute, time.Hour)
+	first, err := pool.get(server.URL, &module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := pool.get(server.URL, &module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Fatal("Expected the same transport for the same target and module")
+	}
+
+	client := &http.Client{Transport: first}
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	if n := atomic.LoadInt32(&newConns); n != 1 {
+		t.Errorf("Expected requests to share one connection, got %d", n)
+	}
+}
+
+func TestClientPoolEvictsUnusedTargets(t *testing.T) {
+	module := config.DefaultModule
+	pool := newClientPool(time.Minute, time.Millisecond)
+	first, err := pool.get("http://sbc1", &module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := pool.get("http://sbc2", &module); err != nil {
+		t.Fatal(err)
+	}
+	pool.mtx.Lock()
+	defer pool.mtx.Unlock()
+	if len(pool.transports) != 1 {
+		t.Errorf("Expected the unused target to be evicted, %d transports left", len(pool.transports))
+	}
+	for _, tr := range pool.transports {
+		if tr == first {
+			t.Error("Unused transport was not evicted")
+		}
+	}
+}